@@ -5,6 +5,7 @@ import (
 	"main/common/db"
 	"main/common/log"
 	"main/internal/account"
+	"main/internal/standingorder"
 	"main/internal/transaction"
 	"net/http"
 	"os"
@@ -40,15 +41,55 @@ func main() {
 	if err != nil {
 		panic("cannot connect to account database")
 	}
-	transactionHandler := transaction.NewHandler(transaction.NewService(transaction.NewRepository(transactionDB), account.NewTCCService(accoundDB), account.NewRepository(accoundDB)))
+	transactionService, err := transaction.NewService(transaction.NewRepository(transactionDB), account.NewTCCService(accoundDB), account.NewRepository(accoundDB))
+	if err != nil {
+		panic("cannot init transaction service: " + err.Error())
+	}
+	transactionHandler := transaction.NewHandler(transactionService)
+	standingOrderHandler := standingorder.NewHandler(standingorder.NewService(standingorder.NewRepository(transactionDB), account.NewRepository(accoundDB), transactionService))
 
 	api := r.Group("/api/v1")
 	{
 		api.POST("/accounts", accountHandler.CreateAccount)
 		api.GET("/accounts/:account_id", accountHandler.QueryAccount)
+		api.POST("/accounts/:account_id/freeze", accountHandler.FreezeAccount)
+		api.POST("/accounts/:account_id/unfreeze", accountHandler.UnfreezeAccount)
+		api.POST("/accounts/:account_id/close", accountHandler.CloseAccount)
+		api.GET("/accounts/:account_id/limits", accountHandler.QueryLimits)
+		api.PUT("/accounts/:account_id/limits", accountHandler.UpdateLimits)
+		api.PUT("/accounts/:account_id/credit_limit", accountHandler.UpdateCreditLimit)
+		api.GET("/accounts/:account_id/statement", accountHandler.QueryStatement)
+		api.GET("/accounts/:account_id/holds", accountHandler.QueryHolds)
+		api.GET("/accounts/:account_id/reconciliation", accountHandler.ReconcileAccount)
+		api.POST("/accounts/:account_id/deposits", transactionHandler.CreateDeposit)
+		api.POST("/accounts/:account_id/withdrawals", transactionHandler.CreateWithdrawal)
 		api.POST("/transactions", transactionHandler.CreateTransaction)
+		api.GET("/transactions", transactionHandler.ListTransactions)
 		api.GET("/transactions/:transaction_id", transactionHandler.QueryTransaction)
+		api.GET("/transactions/:transaction_id/wait", transactionHandler.WaitTransaction)
+		api.GET("/transactions/:transaction_id/events", transactionHandler.QueryTransactionEvents)
 		api.POST("/transactions/retry", transactionHandler.RetryTransaction)
+		api.POST("/transactions/:transaction_id/refunds", transactionHandler.CreateRefund)
+		api.POST("/transactions/:transaction_id/cancel", transactionHandler.CancelTransaction)
+		api.POST("/transactions/:transaction_id/capture", transactionHandler.CaptureTransaction)
+		api.POST("/transactions/:transaction_id/void", transactionHandler.VoidTransaction)
+		api.POST("/transactions/:transaction_id/approve", transactionHandler.ApproveTransaction)
+		api.POST("/transactions/:transaction_id/reject", transactionHandler.RejectTransaction)
+		api.GET("/transactions/:transaction_id/approval", transactionHandler.QueryApproval)
+		api.GET("/operator/transactions", transactionHandler.ListManualTransactions)
+		api.POST("/operator/transactions/:transaction_id/resolve", transactionHandler.ResolveTransaction)
+		api.POST("/batches", transactionHandler.CreateBatch)
+		api.GET("/batches/:batch_id", transactionHandler.QueryBatch)
+		api.POST("/batches/:batch_id/approve", transactionHandler.ApproveBatch)
+		api.POST("/batches/:batch_id/reject", transactionHandler.RejectBatch)
+		api.POST("/standing_orders", standingOrderHandler.CreateStandingOrder)
+		api.GET("/standing_orders", standingOrderHandler.ListStandingOrders)
+		api.GET("/standing_orders/:standing_order_id", standingOrderHandler.QueryStandingOrder)
+		api.PUT("/standing_orders/:standing_order_id", standingOrderHandler.UpdateStandingOrder)
+		api.DELETE("/standing_orders/:standing_order_id", standingOrderHandler.CancelStandingOrder)
+		api.POST("/standing_orders/:standing_order_id/pause", standingOrderHandler.PauseStandingOrder)
+		api.POST("/standing_orders/:standing_order_id/resume", standingOrderHandler.ResumeStandingOrder)
+		api.GET("/standing_orders/:standing_order_id/runs", standingOrderHandler.QueryRuns)
 
 	}
 
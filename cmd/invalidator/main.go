@@ -2,13 +2,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"main/common/config"
 	"main/common/db"
 	"main/common/log"
 	"main/common/recovery"
 	"main/internal/account"
+	"main/internal/standingorder"
 	"main/internal/transaction"
-	"main/model"
 	"time"
 
 	"github.com/spf13/viper"
@@ -21,6 +22,24 @@ func main() {
 
 	ticker := time.NewTicker(time.Minute * time.Duration(viper.GetInt(config.ConfigKeyInvalidateInterval)))
 	defer ticker.Stop()
+	scheduleInterval := viper.GetInt(config.ConfigKeyScheduleInterval)
+	if scheduleInterval <= 0 {
+		scheduleInterval = transaction.DefaultScheduleIntervalSeconds
+	}
+	scheduleTicker := time.NewTicker(time.Second * time.Duration(scheduleInterval))
+	defer scheduleTicker.Stop()
+	retryInterval := viper.GetInt(config.ConfigKeyRetryInterval)
+	if retryInterval <= 0 {
+		retryInterval = transaction.DefaultRetryIntervalSeconds
+	}
+	retryTicker := time.NewTicker(time.Second * time.Duration(retryInterval))
+	defer retryTicker.Stop()
+	relayInterval := viper.GetInt(config.ConfigKeyOutboxRelayInterval)
+	if relayInterval <= 0 {
+		relayInterval = transaction.DefaultOutboxRelayIntervalSeconds
+	}
+	relayTicker := time.NewTicker(time.Second * time.Duration(relayInterval))
+	defer relayTicker.Stop()
 	txnDB, err := db.GetTransactionDB()
 	if err != nil {
 		panic("Could not initialize transaction database")
@@ -31,42 +50,126 @@ func main() {
 	}
 	transactionRepo := transaction.NewRepository(txnDB)
 	accTCC := account.NewTCCService(accDB)
-	ctx := context.Background()
+	transactionService, err := transaction.NewService(transactionRepo, accTCC, account.NewRepository(accDB))
+	if err != nil {
+		panic("Could not initialize transaction service: " + err.Error())
+	}
+	standingOrderService := standingorder.NewService(standingorder.NewRepository(txnDB), account.NewRepository(accDB), transactionService)
+	ctx := transaction.WithActor(context.Background(), transaction.ActorInvalidator)
 
 	go func() {
-		recovery.GoRecovery()
-
+		// A panic stops only the current run, the loop is started again to keep serving next ticks
 		for {
-			select {
-			case <-ticker.C:
-				log.GetSugger().Info("start to invalidate expired transaction")
-				// Run scan jog
-				transactions, err := transactionRepo.QueryExpiredTransactions(ctx)
-				if err != nil {
-					log.GetSugger().Error("query expired transaction error", "err", err)
-				}
+			func() {
+				defer recovery.RecoverAndLog()
+
+				for {
+					select {
+					case <-ticker.C:
+						log.GetSugger().Info("start to invalidate expired transaction")
+						// Run scan jog
+						transactions, err := transactionRepo.QueryExpiredTransactions(ctx)
+						if err != nil {
+							log.GetSugger().Error("query expired transaction error", "err", err)
+						}
 
-				log.GetSugger().Info("get expored transactions", "transactions", transactions)
+						log.GetSugger().Info("get expored transactions", "transactions", transactions)
 
-				for _, txn := range transactions {
-					go func() {
-						if err := accTCC.Cancel(ctx, txn.TransactionID); err != nil && err != account.ErrEmptyRollback {
-							log.GetSugger().Error("failed to cancel", "txn", txn.TransactionID)
+						// Pending transactions are canceled, processing ones are confirmed as their tries all succeeded.
+						// A failed cancel or confirm is retried by retry worker.
+						for _, txn := range transactions {
+							txn := txn
+							go func() {
+								defer recovery.RecoverAndLog()
+								resolved, err := transactionService.InvalidateTransaction(ctx, transaction.QueryTransactionRequest{TransactionID: txn.TransactionID})
+								var transitionErr *transaction.TransitionError
+								if errors.As(err, &transitionErr) {
+									log.GetSugger().Info("skip transaction moved by others", "txn", txn.TransactionID, "status", transitionErr.Current, "err", err)
+									return
+								}
+								if err != nil {
+									log.GetSugger().Error("failed to invalidate transaction", "txn", txn.TransactionID, "err", err)
+									return
+								}
 
+								log.GetSugger().Info("auto invalicated expired transaction", "txn", txn.TransactionID, "status", resolved.TransactionStatus)
+							}()
 						}
 
-						if err := transactionRepo.UpdateTransactionStatus(ctx, txn.TransactionID, model.Failed); err != nil {
-							log.GetSugger().Error("failed to invalidate transaction", "txn", txn.TransactionID)
+						// Authorizations not captured in time are voided to release held fund
+						if err := transactionService.ExpireAuthorizations(ctx, time.Now()); err != nil {
+							log.GetSugger().Error("expire authorizations error", "err", err)
 						}
 
-						log.GetSugger().Info("auto invalicated expired transaction", "txn", txn.TransactionID)
-					}()
+						// Transfers nobody approved or rejected in time are rejected
+						if err := transactionService.ExpireApprovals(ctx, time.Now()); err != nil {
+							log.GetSugger().Error("expire approvals error", "err", err)
+						}
+
+						// Legs of a batch are canceled or confirmed together
+						batches, err := transactionRepo.QueryExpiredBatches(ctx)
+						if err != nil {
+							log.GetSugger().Error("query expired batch error", "err", err)
+						}
+						for _, batch := range batches {
+							batch := batch
+							go func() {
+								resolved, err := transactionService.InvalidateBatch(ctx, transaction.QueryBatchRequest{BatchID: batch.BatchID})
+								if err != nil {
+									log.GetSugger().Error("failed to invalidate batch", "batch", batch.BatchID, "err", err)
+									return
+								}
+								log.GetSugger().Info("auto invalidated expired batch", "batch", batch.BatchID, "status", resolved.BatchStatus)
+							}()
+						}
+					case <-scheduleTicker.C:
+						// Start scheduled transactions which are due
+						transactions, err := transactionRepo.QueryDueScheduledTransactions(ctx, time.Now(), transaction.MaxScheduledTransactionsPerRun)
+						if err != nil {
+							log.GetSugger().Error("query due scheduled transaction error", "err", err)
+						}
+						for _, txn := range transactions {
+							txn := txn
+							go func() {
+								defer recovery.RecoverAndLog()
+								tCtx, cancel := context.WithTimeout(transaction.WithActor(ctx, transaction.ActorScheduler), time.Second*time.Duration(viper.GetInt(config.ConfigKeyCreateTransactionTimeout)))
+								defer cancel()
+								trx, err := transactionService.ExecuteScheduledTransaction(tCtx, transaction.QueryTransactionRequest{TransactionID: txn.TransactionID})
+								if err != nil && err != transaction.ErrTransactionNotScheduled {
+									log.GetSugger().Error("failed to execute scheduled transaction", "txn", txn.TransactionID, "err", err)
+									return
+								}
+								log.GetSugger().Info("executed scheduled transaction", "txn", txn.TransactionID, "status", trx.TransactionStatus)
+							}()
+						}
+
+						// Standing orders run one by one in background, a slow run should not block the ticker
+						go func() {
+							defer recovery.RecoverAndLog()
+							if err := standingOrderService.RunDueStandingOrders(transaction.WithActor(ctx, transaction.ActorStandingOrder), time.Now()); err != nil {
+								log.GetSugger().Error("run due standing orders error", "err", err)
+							}
+						}()
+					case <-retryTicker.C:
+						// Confirm or cancel again the transactions whose retry is due, they survive api restarts
+						go func() {
+							defer recovery.RecoverAndLog()
+							if err := transactionService.RetryDueTransactions(ctx, time.Now()); err != nil {
+								log.GetSugger().Error("retry due transactions error", "err", err)
+							}
+						}()
+					case <-relayTicker.C:
+						// Apply fund movement changes to transactions, in case the process made the change died before updating the transaction
+						if err := transactionService.RelayOutbox(transaction.WithActor(ctx, transaction.ActorOutboxRelay)); err != nil {
+							log.GetSugger().Error("relay outbox error", "err", err)
+						}
+					}
 				}
-			}
+			}()
 		}
 	}()
 
-	log.GetSugger().Info("start invalidator")
+	log.GetSugger().Info("start invalidator, scheduler, retry worker and outbox relay")
 
 	select {}
 }
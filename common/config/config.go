@@ -12,6 +12,33 @@ const (
 	ConfigKeyTryTimeout               = "try_timeout"
 	ConfigKeyTransactionExpiration    = "transaction_expiration"
 	ConfigKeyInvalidateInterval       = "invalidate_interval_minutes"
+	ConfigKeyClearingAccounts         = "clearing_accounts"
+	ConfigKeyScheduleInterval         = "schedule_interval_seconds"
+	// ConfigKeyStandingOrderMaxRetries is the retries of a standing order run failed with insufficient balance
+	ConfigKeyStandingOrderMaxRetries    = "standing_order_max_retries"
+	ConfigKeyStandingOrderRetryInterval = "standing_order_retry_interval_minutes"
+	// ConfigKeyAsyncWorkers is the number of workers processing asynchronous transactions
+	ConfigKeyAsyncWorkers   = "async_workers"
+	ConfigKeyAsyncQueueSize = "async_queue_size"
+	// ConfigKeyRetryBackoff is the backoff of confirm and cancel retries, keyed by TCC phase
+	ConfigKeyRetryBackoff  = "retry_backoff"
+	ConfigKeyRetryInterval = "retry_interval_seconds"
+	// ConfigKeyAuthorizationExpiration is how long an authorized transaction holds fund before it's voided
+	ConfigKeyAuthorizationExpiration = "authorization_expiration_minutes"
+	// ConfigKeyDefaultFee is the fee rule of transfers, it's overridden by the rule of source account under ConfigKeyAccountFees
+	ConfigKeyDefaultFee  = "fees.default"
+	ConfigKeyAccountFees = "fees.accounts"
+	// ConfigKeyFeeAccounts is the system account collecting fees, keyed by currency
+	ConfigKeyFeeAccounts = "fee_accounts"
+	// ConfigKeyApprovalThresholds is the amount above which a transfer needs approval, keyed by currency
+	ConfigKeyApprovalThresholds = "approval.thresholds"
+	ConfigKeyApprovalExpiration = "approval.expiration_minutes"
+	// ConfigKeyApprovers are the users allowed to approve transfers, nobody can approve if it's empty
+	ConfigKeyApprovers = "approval.approvers"
+	// ConfigKeyRiskRules is the chain of risk rules checked before a transfer is saved, see transaction.RiskRuleConfig
+	ConfigKeyRiskRules = "risk.rules"
+	// ConfigKeyOutboxRelayInterval is how often invalidator relays fund movement changes in account outbox to transactions
+	ConfigKeyOutboxRelayInterval = "outbox_relay_interval_seconds"
 )
 
 func Init() {
@@ -28,7 +55,11 @@ func InitForTest() {
 	jsonConfig := `{
         "create_transaction_timeout": "3",
         "max_retries": 2,
-        "try_timeout": 1
+        "try_timeout": 1,
+        "clearing_accounts": {
+            "SGD": 999999001,
+            "USD": 999999002
+        }
     }`
 	viper.SetConfigType("json")
 	if err := viper.ReadConfig(strings.NewReader(jsonConfig)); err != nil {
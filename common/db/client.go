@@ -34,7 +34,7 @@ func GetAccountDBClient() (*gorm.DB, error) {
 			dbHost, dbPort, dbUser, dbPassword, accountDBName)
 
 		var err error
-		accountDB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		accountDB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 		if err != nil {
 			log.GetLogger().Sugar().Infof("failed to connect database: %v", err)
 		}
@@ -56,7 +56,7 @@ func GetTransactionDB() (*gorm.DB, error) {
 			dbHost, dbPort, dbUser, dbPassword, transactionDBName)
 
 		var err error
-		transactionDB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		transactionDB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 		if err != nil {
 			log.GetLogger().Sugar().Infof("failed to connect database: %v", err)
 		}
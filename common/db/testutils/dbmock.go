@@ -7,7 +7,7 @@ import (
 
 func SetupTestDB() (*gorm.DB, error) {
 	// Use an in-memory SQLite database
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
@@ -3,15 +3,9 @@ package recovery
 import "main/common/log"
 
 // RecoverAndLog recovers from panics inside a goroutine and logs the panic information.
+// It must be deferred by the goroutine itself, recover stops only a panic of the goroutine calling it.
 func RecoverAndLog() {
 	if err := recover(); err != nil {
 		log.GetSugger().Error("panic recovered", "err ", err)
 	}
 }
-
-// GoRecovery is a utility function to recover from panics in a goroutine using defer.
-func GoRecovery() {
-	go func() {
-		defer RecoverAndLog()
-	}()
-}
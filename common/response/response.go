@@ -14,6 +14,15 @@ func Ok(c *gin.Context, data interface{}) {
 	})
 }
 
+// Accepted responds a request which will be processed in background, location is where to query its result
+func Accepted(c *gin.Context, location string, data interface{}) {
+	c.Header("Location", location)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "accepted",
+		"data":    data,
+	})
+}
+
 func Err(c *gin.Context, err error) {
 	c.JSON(http.StatusInternalServerError, gin.H{
 		"message": err.Error(),
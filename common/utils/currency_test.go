@@ -16,7 +16,8 @@ func TestSafeAdd(t *testing.T) {
 		{math.MaxInt64, 1, 0, ErrOverflow},
 		{math.MinInt64, -1, 0, ErrOverflow},
 		{math.MaxInt64, -1, math.MaxInt64 - 1, nil},
-		{math.MinInt64, 1, math.MinInt64 + 1, nil},
+		{math.MinInt64, 1, 0, ErrNegativeValue},
+		{1, -2, 0, ErrNegativeValue},
 	}
 
 	for _, test := range tests {
@@ -27,6 +28,27 @@ func TestSafeAdd(t *testing.T) {
 	}
 }
 
+func TestSafeAddSigned(t *testing.T) {
+	tests := []struct {
+		nums   []int64
+		result int64
+		err    error
+	}{
+		{[]int64{1, 2}, 3, nil},
+		{[]int64{1, -2}, -1, nil},
+		{[]int64{math.MinInt64, 1}, math.MinInt64 + 1, nil},
+		{[]int64{math.MinInt64, -1}, 0, ErrOverflow},
+		{[]int64{math.MaxInt64, 1}, 0, ErrOverflow},
+	}
+
+	for _, test := range tests {
+		res, err := SafeAddSigned(test.nums...)
+		if res != test.result || err != test.err {
+			t.Errorf("SafeAddSigned(%v) = (%d, %v), want (%d, %v)", test.nums, res, err, test.result, test.err)
+		}
+	}
+}
+
 func TestParseString(t *testing.T) {
 	tests := []struct {
 		input  string
@@ -67,8 +67,20 @@ func FormatInt(i int64) string {
 	return fmt.Sprintf("%.6f", float64(i)/1e6)
 }
 
-// SafeAdd safely adds multiple int64 values, checking for overflow.
+// SafeAdd safely adds multiple int64 values, checking for overflow and negative sum.
 func SafeAdd(nums ...int64) (int64, error) {
+	sum, err := SafeAddSigned(nums...)
+	if err != nil {
+		return 0, err
+	}
+	if sum < 0 {
+		return 0, ErrNegativeValue
+	}
+	return sum, nil
+}
+
+// SafeAddSigned safely adds multiple int64 values, checking for overflow only, the sum can be negative.
+func SafeAddSigned(nums ...int64) (int64, error) {
 	var sum int64
 	for _, num := range nums {
 		// Check for overflow
@@ -77,8 +89,5 @@ func SafeAdd(nums ...int64) (int64, error) {
 		}
 		sum += num
 	}
-	if sum < 0 {
-		return 0, ErrNegativeValue
-	}
 	return sum, nil
 }
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor encodes a position of a (time, id) ordered list into an opaque cursor string.
+func EncodeCursor(t time.Time, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", t.UnixNano(), id)))
+}
+
+// DecodeCursor decodes a cursor string created by EncodeCursor.
+func DecodeCursor(cursor string) (time.Time, int, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	var (
+		nano int64
+		id   int
+	)
+	if _, err := fmt.Sscanf(string(bs), "%d:%d", &nano, &id); err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, nano), id, nil
+}
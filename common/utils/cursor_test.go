@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	now := time.Now()
+	cursor := EncodeCursor(now, 123)
+
+	decodedTime, decodedID, err := DecodeCursor(cursor)
+	if err != nil || !decodedTime.Equal(now) || decodedID != 123 {
+		t.Errorf("DecodeCursor(%s) = (%v, %d, %v), want (%v, %d, nil)", cursor, decodedTime, decodedID, err, now, 123)
+	}
+
+	for _, invalid := range []string{"abc", "!!!", EncodeCursor(now, 1)[:3]} {
+		if _, _, err := DecodeCursor(invalid); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%s) = %v, want %v", invalid, err, ErrInvalidCursor)
+		}
+	}
+}
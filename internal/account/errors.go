@@ -3,6 +3,7 @@ package account
 import (
 	"errors"
 	"main/common/response"
+	"main/common/utils"
 
 	"gorm.io/gorm"
 )
@@ -10,6 +11,9 @@ import (
 var (
 	errInternalDuplicatedAccount = errors.New("duplicated account")
 	errInvalidRequest            = errors.New("invalid request")
+	errUnsupportedCurrency       = errors.New("unsupported currency")
+	errAccountClosed             = errors.New("account closed")
+	errAccountNotEmpty           = errors.New("account not empty")
 )
 
 var createHandlerErrors = map[error]*response.ExternalResponse{
@@ -21,9 +25,74 @@ var createHandlerErrors = map[error]*response.ExternalResponse{
 		Code:    400,
 		Message: "Invalid Request",
 	},
+	errUnsupportedCurrency: {
+		Code:    400,
+		Message: "Unsupported Currency",
+	},
 }
 
 var queryHandlerErrors = map[error]*response.ExternalResponse{
+	errInvalidRequest: {
+		Code:    400,
+		Message: "Invalid Request",
+	},
+	gorm.ErrRecordNotFound: {
+		Code:    404,
+		Message: "Account ID not found",
+	},
+}
+
+var updateStatusHandlerErrors = map[error]*response.ExternalResponse{
+	errInvalidRequest: {
+		Code:    400,
+		Message: "Invalid Request",
+	},
+	gorm.ErrRecordNotFound: {
+		Code:    404,
+		Message: "Account ID not found",
+	},
+	errAccountClosed: {
+		Code:    409,
+		Message: "Account Is Closed",
+	},
+	errAccountNotEmpty: {
+		Code:    409,
+		Message: "Account Balance Is Not Empty",
+	},
+}
+
+var limitsHandlerErrors = map[error]*response.ExternalResponse{
+	errInvalidRequest: {
+		Code:    400,
+		Message: "Invalid Request",
+	},
+	gorm.ErrRecordNotFound: {
+		Code:    404,
+		Message: "Account ID not found",
+	},
+	utils.ErrNegativeValue: {
+		Code:    400,
+		Message: "Limit Can Not Be Negative",
+	},
+	utils.ErrOverflow: {
+		Code:    400,
+		Message: "Limit Overflow",
+	},
+	utils.ErrTooManyDigits: {
+		Code:    400,
+		Message: "Too Many Digits, We Only Support 6 Digits Most",
+	},
+}
+
+var statementHandlerErrors = map[error]*response.ExternalResponse{
+	errInvalidRequest: {
+		Code:    400,
+		Message: "Invalid Request",
+	},
+	utils.ErrInvalidCursor: {
+		Code:    400,
+		Message: "Invalid Cursor",
+	},
 	gorm.ErrRecordNotFound: {
 		Code:    404,
 		Message: "Account ID not found",
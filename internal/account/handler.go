@@ -1,6 +1,7 @@
 package account
 
 import (
+	"context"
 	"main/common/response"
 	"main/common/utils"
 	"main/model"
@@ -54,11 +55,7 @@ func (h *Handler) QueryAccount(c *gin.Context) {
 			response.MapExternalErrors(c, *returnError, queryHandlerErrors)
 			return
 		}
-		displayAccount := QueryResponse{
-			AccountID: uint64(account.AccountID),
-			Balance:   utils.FormatInt(account.Balance),
-		}
-		response.Ok(c, displayAccount)
+		response.Ok(c, newQueryResponse(account))
 	}()
 	if err := c.ShouldBindUri(&req); err != nil {
 		returnError = &errInvalidRequest
@@ -71,3 +68,288 @@ func (h *Handler) QueryAccount(c *gin.Context) {
 	}
 
 }
+
+func (h *Handler) FreezeAccount(c *gin.Context) {
+	h.updateAccountStatus(c, h.service.FreezeAccount)
+}
+
+func (h *Handler) UnfreezeAccount(c *gin.Context) {
+	h.updateAccountStatus(c, h.service.UnfreezeAccount)
+}
+
+func (h *Handler) CloseAccount(c *gin.Context) {
+	h.updateAccountStatus(c, h.service.CloseAccount)
+}
+
+func (h *Handler) updateAccountStatus(c *gin.Context, update func(ctx context.Context, req QueryAccountRequest) (model.Account, error)) {
+	var (
+		req         QueryAccountRequest
+		returnError *error
+		account     model.Account
+	)
+
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, updateStatusHandlerErrors)
+			return
+		}
+		response.Ok(c, newQueryResponse(account))
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	account, err := update(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func newQueryResponse(account model.Account) QueryResponse {
+	return QueryResponse{
+		AccountID:        uint64(account.AccountID),
+		Balance:          utils.FormatInt(account.Balance),
+		AvailableBalance: utils.FormatInt(account.Balance - account.OutBalance),
+		PendingIn:        utils.FormatInt(account.InBalance),
+		PendingOut:       utils.FormatInt(account.OutBalance),
+		Currency:         account.Currency,
+		Status:           account.Status.String(),
+		CreditLimit:      utils.FormatInt(account.CreditLimit),
+		CreditUsed:       utils.FormatInt(account.CreditUsed()),
+	}
+}
+
+func (h *Handler) QueryLimits(c *gin.Context) {
+	var (
+		req         QueryAccountRequest
+		returnError *error
+		limits      AccountLimits
+	)
+
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, limitsHandlerErrors)
+			return
+		}
+		response.Ok(c, newLimitsResponse(limits))
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	limits, err := h.service.QueryLimits(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) UpdateLimits(c *gin.Context) {
+	var (
+		req         UpdateLimitsRequest
+		returnError *error
+		limits      AccountLimits
+	)
+
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, limitsHandlerErrors)
+			return
+		}
+		response.Ok(c, newLimitsResponse(limits))
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	limits, err := h.service.UpdateLimits(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func newLimitsResponse(limits AccountLimits) LimitsResponse {
+	return LimitsResponse{
+		AccountID:       uint64(limits.AccountID),
+		MaxSingleAmount: utils.FormatInt(limits.MaxSingleAmount),
+		DailyLimit:      utils.FormatInt(limits.DailyLimit),
+		MonthlyLimit:    utils.FormatInt(limits.MonthlyLimit),
+		DailyUsed:       utils.FormatInt(limits.DailyUsed),
+		MonthlyUsed:     utils.FormatInt(limits.MonthlyUsed),
+	}
+}
+
+func (h *Handler) QueryStatement(c *gin.Context) {
+	var (
+		req         StatementRequest
+		returnError *error
+		entries     []StatementEntry
+		nextCursor  string
+	)
+
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, statementHandlerErrors)
+			return
+		}
+		resp := StatementResponse{
+			AccountID:  req.AccountID,
+			Entries:    make([]StatementEntryResponse, 0, len(entries)),
+			NextCursor: nextCursor,
+		}
+		for _, entry := range entries {
+			resp.Entries = append(resp.Entries, newStatementEntryResponse(int(req.AccountID), entry))
+		}
+		response.Ok(c, resp)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	entries, nextCursor, err := h.service.QueryStatement(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func newStatementEntryResponse(accountID int, entry StatementEntry) StatementEntryResponse {
+	resp := StatementEntryResponse{
+		TransactionID:         entry.TransactionID,
+		Type:                  "credit",
+		CounterpartyAccountID: entry.SourceAccountID,
+		Amount:                utils.FormatInt(entry.AmountOf(accountID)),
+		BalanceAfter:          utils.FormatInt(entry.BalanceAfter),
+		Currency:              entry.Currency,
+		ConfirmedAt:           entry.UpdatedAt,
+	}
+	if entry.SourceAccountID == accountID {
+		resp.Type = "debit"
+		resp.CounterpartyAccountID = entry.DestinationAccountID
+		if entry.Fee > 0 {
+			resp.Fee = utils.FormatInt(entry.Fee)
+		}
+	}
+	return resp
+}
+
+func (h *Handler) ReconcileAccount(c *gin.Context) {
+	var (
+		req         QueryAccountRequest
+		returnError *error
+		account     model.Account
+		ledger      LedgerBalances
+	)
+
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, queryHandlerErrors)
+			return
+		}
+		response.Ok(c, ReconciliationResponse{
+			AccountID:        uint64(account.AccountID),
+			Matched:          ledger.Balance == account.Balance && ledger.InBalance == account.InBalance && ledger.OutBalance == account.OutBalance,
+			Balance:          utils.FormatInt(account.Balance),
+			InBalance:        utils.FormatInt(account.InBalance),
+			OutBalance:       utils.FormatInt(account.OutBalance),
+			LedgerBalance:    utils.FormatInt(ledger.Balance),
+			LedgerInBalance:  utils.FormatInt(ledger.InBalance),
+			LedgerOutBalance: utils.FormatInt(ledger.OutBalance),
+		})
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	account, ledger, err := h.service.ReconcileAccount(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) UpdateCreditLimit(c *gin.Context) {
+	var (
+		req         UpdateCreditLimitRequest
+		returnError *error
+		account     model.Account
+	)
+
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, limitsHandlerErrors)
+			return
+		}
+		response.Ok(c, newQueryResponse(account))
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	account, err := h.service.UpdateCreditLimit(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) QueryHolds(c *gin.Context) {
+	var (
+		req         QueryAccountRequest
+		returnError *error
+		holds       []model.FundMovement
+	)
+
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, queryHandlerErrors)
+			return
+		}
+		resp := HoldsResponse{
+			AccountID: req.AccountID,
+			Holds:     make([]HoldResponse, 0, len(holds)),
+		}
+		for _, fm := range holds {
+			hold := HoldResponse{
+				TransactionID:         fm.TransactionID,
+				Type:                  "in",
+				CounterpartyAccountID: fm.SourceAccountID,
+				Amount:                utils.FormatInt(fm.AmountOf(int(req.AccountID))),
+				Currency:              fm.Currency,
+				CreatedAt:             fm.CreatedAt,
+			}
+			if fm.SourceAccountID == int(req.AccountID) {
+				hold.Type = "out"
+				hold.CounterpartyAccountID = fm.DestinationAccountID
+				if fm.Fee > 0 {
+					hold.Fee = utils.FormatInt(fm.Fee)
+				}
+			}
+			resp.Holds = append(resp.Holds, hold)
+		}
+		response.Ok(c, resp)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	holds, err := h.service.QueryHolds(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
@@ -1,9 +1,21 @@
 package account
 
+import (
+	"time"
+
+	. "main/model"
+)
+
+const (
+	DefaultStatementLimit = 20
+	MaxStatementLimit     = 100
+)
+
 type (
 	CreateAccountRequest struct {
 		AccountID      uint64 `json:"account_id" binding:"required"`
 		InitialBalance string `json:"initial_balance"`
+		Currency       string `json:"currency"` // Optional, default is model.DefaultCurrency
 	}
 
 	// CreateAccountResponse represents the JSON response body structure
@@ -18,7 +30,126 @@ type (
 
 	// CreateAccountResponse represents the JSON response body structure
 	QueryResponse struct {
-		AccountID uint64 `json:"account_id"`
-		Balance   string `json:"balance"`
+		AccountID        uint64 `json:"account_id"`
+		Balance          string `json:"balance"`
+		AvailableBalance string `json:"available_balance"`
+		PendingIn        string `json:"pending_in"`
+		PendingOut       string `json:"pending_out"`
+		Currency         string `json:"currency"`
+		Status           string `json:"status"`
+		CreditLimit      string `json:"credit_limit"`
+		CreditUsed       string `json:"credit_used"`
+	}
+
+	UpdateCreditLimitRequest struct {
+		AccountID   uint64 `uri:"account_id" json:"-" binding:"required"`
+		CreditLimit string `json:"credit_limit" binding:"required"` // 0 means no credit line
+	}
+
+	UpdateLimitsRequest struct {
+		AccountID       uint64  `uri:"account_id" json:"-" binding:"required"`
+		MaxSingleAmount *string `json:"max_single_amount"` // Optional, omitted keeps the limit, empty or 0 means no limit
+		DailyLimit      *string `json:"daily_limit"`       // Optional, omitted keeps the limit, empty or 0 means no limit
+		MonthlyLimit    *string `json:"monthly_limit"`     // Optional, omitted keeps the limit, empty or 0 means no limit
+	}
+
+	// LimitsUpdate is the limits to change, nil fields are kept
+	LimitsUpdate struct {
+		MaxSingleAmount *int64
+		DailyLimit      *int64
+		MonthlyLimit    *int64
+	}
+
+	// AccountLimits represents account's transfer limits and the amount already used
+	AccountLimits struct {
+		AccountID       int
+		MaxSingleAmount int64
+		DailyLimit      int64
+		MonthlyLimit    int64
+		DailyUsed       int64
+		MonthlyUsed     int64
+	}
+
+	LimitsResponse struct {
+		AccountID       uint64 `json:"account_id"`
+		MaxSingleAmount string `json:"max_single_amount"`
+		DailyLimit      string `json:"daily_limit"`
+		MonthlyLimit    string `json:"monthly_limit"`
+		DailyUsed       string `json:"daily_used"`
+		MonthlyUsed     string `json:"monthly_used"`
+	}
+
+	StatementRequest struct {
+		AccountID uint64    `uri:"account_id" form:"-" binding:"required"`
+		Cursor    string    `form:"cursor"`
+		From      time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"` // Optional, inclusive
+		To        time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`   // Optional, exclusive
+		Limit     int       `form:"limit"`
+	}
+
+	// StatementQuery is the query of confirmed fund movements of an account, ordered from the latest to the oldest
+	StatementQuery struct {
+		AccountID  int
+		From       time.Time
+		To         time.Time
+		BeforeTime time.Time // cursor position, zero value means start from the latest
+		BeforeID   int
+		Limit      int
+	}
+
+	// StatementEntry is a confirmed fund movement of an account with the balance after it's confirmed
+	StatementEntry struct {
+		FundMovement
+		BalanceAfter int64
+	}
+
+	StatementEntryResponse struct {
+		TransactionID         string    `json:"transaction_id"`
+		Type                  string    `json:"type"` // debit or credit
+		CounterpartyAccountID int       `json:"counterparty_account_id"`
+		Amount                string    `json:"amount"`
+		Fee                   string    `json:"fee,omitempty"` // part of a debit amount paid as fee
+		BalanceAfter          string    `json:"balance_after"`
+		Currency              string    `json:"currency"`
+		ConfirmedAt           time.Time `json:"confirmed_at"`
+	}
+
+	StatementResponse struct {
+		AccountID  uint64                   `json:"account_id"`
+		Entries    []StatementEntryResponse `json:"entries"`
+		NextCursor string                   `json:"next_cursor,omitempty"`
+	}
+
+	// LedgerBalances is account balances projected from ledger entries
+	LedgerBalances struct {
+		Balance    int64
+		InBalance  int64
+		OutBalance int64
+	}
+
+	ReconciliationResponse struct {
+		AccountID        uint64 `json:"account_id"`
+		Matched          bool   `json:"matched"`
+		Balance          string `json:"balance"`
+		InBalance        string `json:"in_balance"`
+		OutBalance       string `json:"out_balance"`
+		LedgerBalance    string `json:"ledger_balance"`
+		LedgerInBalance  string `json:"ledger_in_balance"`
+		LedgerOutBalance string `json:"ledger_out_balance"`
+	}
+
+	HoldResponse struct {
+		TransactionID         string    `json:"transaction_id"`
+		Type                  string    `json:"type"` // in or out
+		CounterpartyAccountID int       `json:"counterparty_account_id"`
+		Amount                string    `json:"amount"`
+		Fee                   string    `json:"fee,omitempty"` // part of an out amount held as fee
+		Currency              string    `json:"currency"`
+		CreatedAt             time.Time `json:"created_at"`
+	}
+
+	HoldsResponse struct {
+		AccountID uint64         `json:"account_id"`
+		Holds     []HoldResponse `json:"holds"`
 	}
 )
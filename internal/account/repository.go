@@ -2,21 +2,33 @@ package account
 
 import (
 	"context"
-	"strings"
+	"errors"
+	"time"
 
 	. "main/model"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // TODO: Add timeout in implementation
 type AccountRepository interface {
 	CreateAccount(ctx context.Context, account *Account) error
 	GetAccountByID(ctx context.Context, id int) (Account, error)
+	UpdateAccountStatus(ctx context.Context, id int, status AccountStatus) (Account, error)
+	UpdateAccountLimits(ctx context.Context, id int, limits LimitsUpdate) (Account, error)
+	SumOutgoingAmount(ctx context.Context, id int, since time.Time) (int64, error)
+	UpdateCreditLimit(ctx context.Context, id int, creditLimit int64) (Account, error)
 
 	CreateFundMovement(ctx context.Context, fm *FundMovement) error
 	GetFundMovement(ctx context.Context, query FundMovement) (*FundMovement, error)
 	QueryFundMovement(ctx context.Context, transactionID string) ([]FundMovement, error)
+	QueryStatement(ctx context.Context, query StatementQuery) ([]StatementEntry, error)
+	QueryTriedFundMovements(ctx context.Context, accountID int) ([]FundMovement, error)
+	GetLedgerBalances(ctx context.Context, id int) (LedgerBalances, error)
+
+	QueryOutboxEvents(ctx context.Context, limit int) ([]OutboxEvent, error)
+	MarkOutboxEventRelayed(ctx context.Context, id int64, relayedAt time.Time) error
 }
 
 type repository struct {
@@ -27,9 +39,19 @@ func NewRepository(db *gorm.DB) AccountRepository {
 	return &repository{db: db}
 }
 
+// CreateAccount creates the account, and records its initial balance in ledger
 func (r *repository) CreateAccount(_ context.Context, account *Account) error {
-	if err := r.db.Create(account).Error; err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "constraint") {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(account).Error; err != nil {
+			return err
+		}
+		if account.Balance == 0 {
+			return nil
+		}
+		return writeLedger(tx, NewOpeningJournal(account.AccountID, account.Balance, account.Currency))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return errInternalDuplicatedAccount
 		}
 		return err
@@ -47,6 +69,75 @@ func (r *repository) GetAccountByID(_ context.Context, accountID int) (Account,
 	return acc, nil
 }
 
+// UpdateAccountStatus locks the account and moves it to the given status.
+// Closed is a final status, and only account without any balance or holding amount can be closed.
+func (r *repository) UpdateAccountStatus(ctx context.Context, accountID int, status AccountStatus) (Account, error) {
+	var acc Account
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "Update"}).First(&acc, Account{AccountID: accountID}).Error; err != nil {
+			return err
+		}
+		if acc.Status == status {
+			return nil
+		}
+		if acc.Status == AccountClosed {
+			return errAccountClosed
+		}
+		if status == AccountClosed && (acc.Balance != 0 || acc.InBalance != 0 || acc.OutBalance != 0) {
+			return errAccountNotEmpty
+		}
+		if err := tx.Model(Account{}).Where("account_id = ?", accountID).Update("status", status).Error; err != nil {
+			return err
+		}
+		acc.Status = status
+		return nil
+	})
+	if err != nil {
+		return Account{}, err
+	}
+	return acc, nil
+}
+
+// UpdateAccountLimits updates the limits given in limits, the others are kept
+func (r *repository) UpdateAccountLimits(ctx context.Context, accountID int, limits LimitsUpdate) (Account, error) {
+	columns := map[string]interface{}{}
+	if limits.MaxSingleAmount != nil {
+		columns["max_single_amount"] = *limits.MaxSingleAmount
+	}
+	if limits.DailyLimit != nil {
+		columns["daily_limit"] = *limits.DailyLimit
+	}
+	if limits.MonthlyLimit != nil {
+		columns["monthly_limit"] = *limits.MonthlyLimit
+	}
+	if len(columns) == 0 {
+		return r.GetAccountByID(ctx, accountID)
+	}
+	result := r.db.WithContext(ctx).Model(Account{}).Where("account_id = ?", accountID).Updates(columns)
+	if result.Error != nil {
+		return Account{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Account{}, gorm.ErrRecordNotFound
+	}
+	return r.GetAccountByID(ctx, accountID)
+}
+
+func (r *repository) UpdateCreditLimit(ctx context.Context, accountID int, creditLimit int64) (Account, error) {
+	result := r.db.WithContext(ctx).Model(Account{}).Where("account_id = ?", accountID).Update("credit_limit", creditLimit)
+	if result.Error != nil {
+		return Account{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return Account{}, gorm.ErrRecordNotFound
+	}
+	return r.GetAccountByID(ctx, accountID)
+}
+
+func (r *repository) SumOutgoingAmount(ctx context.Context, accountID int, since time.Time) (int64, error) {
+	return sumOutgoingAmount(r.db.WithContext(ctx), accountID, since)
+}
+
 func (r *repository) countAccount(_ context.Context) (int64, error) {
 	var count int64
 	if err := r.db.Model(Account{}).Count(&count).Error; err != nil {
@@ -73,7 +164,7 @@ func (r *repository) CreateFundMovement(_ context.Context, fm *FundMovement) err
 }
 
 func (r *repository) QueryFundMovement(_ context.Context, transactionID string) ([]FundMovement, error) {
-	var fundmvmts = make([]FundMovement, 3) // there are only 2(I'm thinking to add a refund type for mannual refund) and trx_id - fund_movement_type is unique key
+	var fundmvmts []FundMovement
 
 	if err := r.db.Model(FundMovement{}).Where("transaction_id = ?", transactionID).Find(&fundmvmts).Error; err != nil {
 		return nil, err
@@ -81,3 +172,113 @@ func (r *repository) QueryFundMovement(_ context.Context, transactionID string)
 
 	return fundmvmts, nil
 }
+
+// QueryTriedFundMovements loads fund movements holding amount on the account's in_balance or out_balance
+func (r *repository) QueryTriedFundMovements(ctx context.Context, accountID int) ([]FundMovement, error) {
+	var fundmvmts []FundMovement
+	if err := r.db.WithContext(ctx).Model(FundMovement{}).
+		Where("stage = ?", Tried).
+		Where("source_account_id = ? OR destination_account_id = ? OR fee_account_id = ?", accountID, accountID, accountID).
+		Order("id").
+		Find(&fundmvmts).Error; err != nil {
+		return nil, err
+	}
+	return fundmvmts, nil
+}
+
+// QueryStatement loads a page of confirmed fund movements of the account, ordered by confirmed time from the latest.
+// The balance after each movement is calculated back from the current balance, so the account row is
+// share locked to make sure no movement is confirmed in between.
+func (r *repository) QueryStatement(ctx context.Context, query StatementQuery) ([]StatementEntry, error) {
+	var entries []StatementEntry
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var acc Account
+		if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&acc, Account{AccountID: query.AccountID}).Error; err != nil {
+			return err
+		}
+
+		movements := tx.Model(FundMovement{}).
+			Where("stage = ?", Confirmed).
+			Where("source_account_id = ? OR destination_account_id = ? OR fee_account_id = ?", query.AccountID, query.AccountID, query.AccountID)
+
+		page := movements.Session(&gorm.Session{})
+		if !query.BeforeTime.IsZero() {
+			page = page.Where("updated_at < ? OR (updated_at = ? AND id < ?)", query.BeforeTime, query.BeforeTime, query.BeforeID)
+		}
+		if !query.From.IsZero() {
+			page = page.Where("updated_at >= ?", query.From)
+		}
+		if !query.To.IsZero() {
+			page = page.Where("updated_at < ?", query.To)
+		}
+		var fms []FundMovement
+		if err := page.Order("updated_at DESC, id DESC").Limit(query.Limit).Find(&fms).Error; err != nil {
+			return err
+		}
+		if len(fms) == 0 {
+			return nil
+		}
+
+		// net amount of all movements confirmed after the first entry in this page
+		var laterNet int64
+		first := fms[0]
+		if err := movements.Session(&gorm.Session{}).
+			Select("COALESCE(SUM(CASE WHEN destination_account_id = ? THEN amount WHEN fee_account_id = ? THEN fee ELSE -(amount + fee) END), 0)",
+				query.AccountID, query.AccountID).
+			Where("updated_at > ? OR (updated_at = ? AND id > ?)", first.UpdatedAt, first.UpdatedAt, first.ID).
+			Scan(&laterNet).Error; err != nil {
+			return err
+		}
+
+		balance := acc.Balance - laterNet
+		entries = make([]StatementEntry, 0, len(fms))
+		for _, fm := range fms {
+			entries = append(entries, StatementEntry{FundMovement: fm, BalanceAfter: balance})
+			if fm.SourceAccountID == query.AccountID {
+				balance += fm.AmountOf(query.AccountID)
+			} else {
+				balance -= fm.AmountOf(query.AccountID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetLedgerBalances projects account's balance, in_balance and out_balance from ledger entries
+func (r *repository) GetLedgerBalances(ctx context.Context, accountID int) (LedgerBalances, error) {
+	var balances LedgerBalances
+	if err := r.db.WithContext(ctx).Model(LedgerEntry{}).
+		Select(`COALESCE(SUM(CASE WHEN book = ? AND direction = ? THEN amount WHEN book = ? THEN -amount ELSE 0 END), 0) AS balance,
+			COALESCE(SUM(CASE WHEN book = ? AND direction = ? THEN amount WHEN book = ? THEN -amount ELSE 0 END), 0) AS in_balance,
+			COALESCE(SUM(CASE WHEN book = ? AND direction = ? THEN amount WHEN book = ? THEN -amount ELSE 0 END), 0) AS out_balance`,
+			BookBalance, Credit, BookBalance,
+			BookInHold, Credit, BookInHold,
+			BookOutHold, Debit, BookOutHold).
+		Where("account_id = ?", accountID).
+		Scan(&balances).Error; err != nil {
+		return LedgerBalances{}, err
+	}
+	return balances, nil
+}
+
+// QueryOutboxEvents loads the outbox events not relayed yet, from the oldest to the latest
+func (r *repository) QueryOutboxEvents(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := r.db.WithContext(ctx).
+		Where("relayed_at IS NULL").
+		Order("id").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// MarkOutboxEventRelayed marks the event as applied to its transaction, it's not loaded by QueryOutboxEvents any more
+func (r *repository) MarkOutboxEventRelayed(ctx context.Context, id int64, relayedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&OutboxEvent{}).
+		Where("id = ?", id).
+		Update("relayed_at", relayedAt).Error
+}
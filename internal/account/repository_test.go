@@ -23,6 +23,8 @@ func prepareRepo() (AccountRepository, error) {
 		return nil, err
 	}
 	_ = db.AutoMigrate(model.Account{})
+	_ = db.AutoMigrate(model.LedgerEntry{})
+	_ = db.AutoMigrate(model.OutboxEvent{})
 	return &repository{db}, nil
 }
 
@@ -86,3 +88,59 @@ func TestGetAccount_NoData(t *testing.T) {
 	assert.Error(t, err, "failed to create account")
 	assert.EqualError(t, gorm.ErrRecordNotFound, err.Error())
 }
+
+func TestUpdateAccountStatus(t *testing.T) {
+	repo, err := prepareRepo()
+	assert.NoError(t, err, "failed to test")
+
+	err = repo.CreateAccount(context.Background(), &Account{AccountID: 1, Balance: 100})
+	assert.NoError(t, err, "failed to create account")
+	err = repo.CreateAccount(context.Background(), &Account{AccountID: 2})
+	assert.NoError(t, err, "failed to create account")
+
+	acc, err := repo.UpdateAccountStatus(context.Background(), 1, AccountFrozen)
+	assert.NoError(t, err)
+	assert.Equal(t, AccountFrozen, acc.Status)
+
+	acc, err = repo.UpdateAccountStatus(context.Background(), 1, AccountActive)
+	assert.NoError(t, err)
+	assert.Equal(t, AccountActive, acc.Status)
+
+	_, err = repo.UpdateAccountStatus(context.Background(), 1, AccountClosed)
+	assert.EqualError(t, errAccountNotEmpty, err.Error())
+
+	acc, err = repo.UpdateAccountStatus(context.Background(), 2, AccountClosed)
+	assert.NoError(t, err)
+	assert.Equal(t, AccountClosed, acc.Status)
+
+	_, err = repo.UpdateAccountStatus(context.Background(), 2, AccountActive)
+	assert.EqualError(t, errAccountClosed, err.Error())
+
+	_, err = repo.UpdateAccountStatus(context.Background(), 3, AccountFrozen)
+	assert.EqualError(t, gorm.ErrRecordNotFound, err.Error())
+}
+
+func TestUpdateAccountLimits_ShouldKeepOmittedLimits(t *testing.T) {
+	repo, err := prepareRepo()
+	assert.NoError(t, err, "failed to test")
+	ctx := context.Background()
+
+	err = repo.CreateAccount(ctx, &Account{AccountID: 1, MaxSingleAmount: 100, DailyLimit: 500, MonthlyLimit: 2000})
+	assert.NoError(t, err, "failed to create account")
+
+	dailyLimit, noLimit := int64(800), int64(0)
+	acc, err := repo.UpdateAccountLimits(ctx, 1, LimitsUpdate{DailyLimit: &dailyLimit})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), acc.MaxSingleAmount)
+	assert.Equal(t, int64(800), acc.DailyLimit)
+	assert.Equal(t, int64(2000), acc.MonthlyLimit)
+
+	acc, err = repo.UpdateAccountLimits(ctx, 1, LimitsUpdate{MonthlyLimit: &noLimit})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), acc.MaxSingleAmount)
+	assert.Equal(t, int64(800), acc.DailyLimit)
+	assert.Equal(t, int64(0), acc.MonthlyLimit)
+
+	_, err = repo.UpdateAccountLimits(ctx, 2, LimitsUpdate{DailyLimit: &dailyLimit})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"main/common/log"
 	"main/common/utils"
+	"strings"
 	"sync"
+	"time"
 
 	. "main/model"
 
@@ -14,6 +16,15 @@ import (
 type Service interface {
 	CreateAccount(ctx context.Context, req CreateAccountRequest) error
 	QueryAccount(ctx context.Context, req QueryAccountRequest) (Account, error)
+	FreezeAccount(ctx context.Context, req QueryAccountRequest) (Account, error)
+	UnfreezeAccount(ctx context.Context, req QueryAccountRequest) (Account, error)
+	CloseAccount(ctx context.Context, req QueryAccountRequest) (Account, error)
+	QueryLimits(ctx context.Context, req QueryAccountRequest) (AccountLimits, error)
+	UpdateLimits(ctx context.Context, req UpdateLimitsRequest) (AccountLimits, error)
+	QueryStatement(ctx context.Context, req StatementRequest) ([]StatementEntry, string, error)
+	ReconcileAccount(ctx context.Context, req QueryAccountRequest) (Account, LedgerBalances, error)
+	UpdateCreditLimit(ctx context.Context, req UpdateCreditLimitRequest) (Account, error)
+	QueryHolds(ctx context.Context, req QueryAccountRequest) ([]FundMovement, error)
 }
 
 type accountService struct {
@@ -44,10 +55,15 @@ func (s *accountService) CreateAccount(ctx context.Context, req CreateAccountReq
 		log.GetLogger().Error(err.Error())
 		return err
 	}
+	currency, err := normalizeCurrency(req.Currency)
+	if err != nil {
+		return err
+	}
 
 	err = s.repo.CreateAccount(ctx, &Account{
 		AccountID: int(req.AccountID),
 		Balance:   inflatedValue,
+		Currency:  currency,
 	})
 	if err != nil {
 		log.GetLogger().Error(err.Error())
@@ -60,3 +76,183 @@ func (s *accountService) CreateAccount(ctx context.Context, req CreateAccountReq
 func (s *accountService) QueryAccount(ctx context.Context, req QueryAccountRequest) (Account, error) {
 	return s.repo.GetAccountByID(ctx, int(req.AccountID))
 }
+
+// FreezeAccount blocks all outgoing transfers of the account, incoming transfers are still allowed.
+func (s *accountService) FreezeAccount(ctx context.Context, req QueryAccountRequest) (Account, error) {
+	return s.updateStatus(ctx, int(req.AccountID), AccountFrozen)
+}
+
+func (s *accountService) UnfreezeAccount(ctx context.Context, req QueryAccountRequest) (Account, error) {
+	return s.updateStatus(ctx, int(req.AccountID), AccountActive)
+}
+
+// CloseAccount blocks all transfers of the account. A closed account can not be reopened.
+func (s *accountService) CloseAccount(ctx context.Context, req QueryAccountRequest) (Account, error) {
+	return s.updateStatus(ctx, int(req.AccountID), AccountClosed)
+}
+
+func (s *accountService) updateStatus(ctx context.Context, accountID int, status AccountStatus) (Account, error) {
+	acc, err := s.repo.UpdateAccountStatus(ctx, accountID, status)
+	if err != nil {
+		log.GetSugger().Error("failed to update account status", "accountID", accountID, "status", status.String(), "err", err)
+		return Account{}, err
+	}
+	log.GetSugger().Info("account status updated", "accountID", accountID, "status", status.String())
+	return acc, nil
+}
+
+func (s *accountService) QueryLimits(ctx context.Context, req QueryAccountRequest) (AccountLimits, error) {
+	acc, err := s.repo.GetAccountByID(ctx, int(req.AccountID))
+	if err != nil {
+		return AccountLimits{}, err
+	}
+	return s.buildLimits(ctx, acc)
+}
+
+func (s *accountService) UpdateLimits(ctx context.Context, req UpdateLimitsRequest) (AccountLimits, error) {
+	var limits LimitsUpdate
+	for _, field := range []struct {
+		value *string
+		limit **int64
+	}{
+		{req.MaxSingleAmount, &limits.MaxSingleAmount},
+		{req.DailyLimit, &limits.DailyLimit},
+		{req.MonthlyLimit, &limits.MonthlyLimit},
+	} {
+		// omitted limit is kept
+		if field.value == nil {
+			continue
+		}
+		var inflatedValue int64
+		if strings.TrimSpace(*field.value) != "" {
+			var err error
+			if inflatedValue, err = utils.ParseString(*field.value); err != nil {
+				return AccountLimits{}, err
+			}
+			if inflatedValue < 0 {
+				return AccountLimits{}, utils.ErrNegativeValue
+			}
+		}
+		*field.limit = &inflatedValue
+	}
+
+	acc, err := s.repo.UpdateAccountLimits(ctx, int(req.AccountID), limits)
+	if err != nil {
+		log.GetSugger().Error("failed to update account limits", "accountID", req.AccountID, "err", err)
+		return AccountLimits{}, err
+	}
+	log.GetSugger().Info("account limits updated", "accountID", req.AccountID, "limits", limits)
+	return s.buildLimits(ctx, acc)
+}
+
+// UpdateCreditLimit sets the credit line of the account. Lowering the credit limit doesn't affect
+// the credit already in use, but the account can not send fund out until it's back within the limit.
+func (s *accountService) UpdateCreditLimit(ctx context.Context, req UpdateCreditLimitRequest) (Account, error) {
+	creditLimit, err := utils.ParseString(req.CreditLimit)
+	if err != nil {
+		return Account{}, err
+	}
+	if creditLimit < 0 {
+		return Account{}, utils.ErrNegativeValue
+	}
+	acc, err := s.repo.UpdateCreditLimit(ctx, int(req.AccountID), creditLimit)
+	if err != nil {
+		log.GetSugger().Error("failed to update credit limit", "accountID", req.AccountID, "err", err)
+		return Account{}, err
+	}
+	log.GetSugger().Info("credit limit updated", "accountID", req.AccountID, "creditLimit", creditLimit)
+	return acc, nil
+}
+
+func (s *accountService) buildLimits(ctx context.Context, acc Account) (AccountLimits, error) {
+	now := time.Now()
+	dailyUsed, err := s.repo.SumOutgoingAmount(ctx, acc.AccountID, startOfDay(now))
+	if err != nil {
+		return AccountLimits{}, err
+	}
+	monthlyUsed, err := s.repo.SumOutgoingAmount(ctx, acc.AccountID, startOfMonth(now))
+	if err != nil {
+		return AccountLimits{}, err
+	}
+	return AccountLimits{
+		AccountID:       acc.AccountID,
+		MaxSingleAmount: acc.MaxSingleAmount,
+		DailyLimit:      acc.DailyLimit,
+		MonthlyLimit:    acc.MonthlyLimit,
+		DailyUsed:       dailyUsed,
+		MonthlyUsed:     monthlyUsed,
+	}, nil
+}
+
+// QueryStatement returns a page of confirmed debits and credits of the account, and the cursor of next page.
+// Empty cursor means there is no more entries.
+func (s *accountService) QueryStatement(ctx context.Context, req StatementRequest) ([]StatementEntry, string, error) {
+	query := StatementQuery{
+		AccountID: int(req.AccountID),
+		From:      req.From,
+		To:        req.To,
+		Limit:     req.Limit,
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultStatementLimit
+	}
+	if query.Limit > MaxStatementLimit {
+		query.Limit = MaxStatementLimit
+	}
+	if req.Cursor != "" {
+		beforeTime, beforeID, err := utils.DecodeCursor(req.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query.BeforeTime, query.BeforeID = beforeTime, beforeID
+	}
+
+	// load one more entry to know if there is a next page
+	query.Limit++
+	entries, err := s.repo.QueryStatement(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(entries) < query.Limit {
+		return entries, "", nil
+	}
+	entries = entries[:len(entries)-1]
+	last := entries[len(entries)-1]
+	return entries, utils.EncodeCursor(last.UpdatedAt, last.ID), nil
+}
+
+// QueryHolds returns the tried fund movements behind account's pending in and pending out balance
+func (s *accountService) QueryHolds(ctx context.Context, req QueryAccountRequest) ([]FundMovement, error) {
+	if _, err := s.repo.GetAccountByID(ctx, int(req.AccountID)); err != nil {
+		return nil, err
+	}
+	return s.repo.QueryTriedFundMovements(ctx, int(req.AccountID))
+}
+
+// ReconcileAccount loads the account and its balances projected from ledger, so they can be checked against each other
+func (s *accountService) ReconcileAccount(ctx context.Context, req QueryAccountRequest) (Account, LedgerBalances, error) {
+	acc, err := s.repo.GetAccountByID(ctx, int(req.AccountID))
+	if err != nil {
+		return Account{}, LedgerBalances{}, err
+	}
+	balances, err := s.repo.GetLedgerBalances(ctx, acc.AccountID)
+	if err != nil {
+		return Account{}, LedgerBalances{}, err
+	}
+	if balances.Balance != acc.Balance || balances.InBalance != acc.InBalance || balances.OutBalance != acc.OutBalance {
+		log.GetSugger().Error("account balances mismatch with ledger", "account", acc, "ledger", balances)
+	}
+	return acc, balances, nil
+}
+
+// normalizeCurrency upper-cases the currency code and falls back to the default currency when empty.
+func normalizeCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency, nil
+	}
+	if !SupportedCurrencies[currency] {
+		return "", errUnsupportedCurrency
+	}
+	return currency, nil
+}
@@ -8,6 +8,7 @@ import (
 	"main/common/utils"
 	"main/model"
 	. "main/model"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -30,16 +31,53 @@ var (
 	ErrFailedToRollback              = errors.New("failed to rollback")
 	ErrEmptyRollback                 = errors.New("empty rollback")
 	ErrUnknowStage                   = errors.New("unknow fund movement status")
+	ErrCurrencyMismatch              = errors.New("currency mismatch")
+	ErrSourceAccountFrozen           = errors.New("source account frozen")
+	ErrSourceAccountClosed           = errors.New("source account closed")
+	ErrDestinationAccountClosed      = errors.New("destination account closed")
+	ErrExceedingDailyLimit           = errors.New("exceeding daily limit")
+	ErrExceedingMonthlyLimit         = errors.New("exceeding monthly limit")
+	ErrFailedToWriteLedger           = errors.New("failed to write ledger")
+	ErrFailedToWriteOutbox           = errors.New("failed to write outbox")
+	ErrCreditLimitExceeded           = errors.New("credit limit exceeded")
+	// ErrInvalidFeeAccount indicates fee account is closed, in another currency, or one side of the transfer
+	ErrInvalidFeeAccount = errors.New("invalid fee account")
 )
 
 type TCC interface {
-	Try(ctx context.Context, transactionID string, sourceAccountID, destinationAccountID int, amount int64) error
+	Try(ctx context.Context, transactionID string, sourceAccountID, destinationAccountID int, amount int64, opts ...TryOption) error
 
 	Confirm(ctx context.Context, transactionID string) error
 
 	Cancel(ctx context.Context, transactionID string) error
 }
 
+// TryOption customizes the checks done by Try
+type TryOption func(*tryOptions)
+
+type tryOptions struct {
+	skipTransferLimits bool
+	fee                int64
+	feeAccountID       int
+}
+
+// WithoutTransferLimits skips the transfer limits of source account. Refunds return fund received before,
+// so they should not be blocked by the limits of the refunding account.
+func WithoutTransferLimits() TryOption {
+	return func(o *tryOptions) {
+		o.skipTransferLimits = true
+	}
+}
+
+// WithFee charges fee from source on top of the amount. Fee is held and confirmed together with the amount,
+// and credited to the fee account.
+func WithFee(feeAccountID int, fee int64) TryOption {
+	return func(o *tryOptions) {
+		o.fee = fee
+		o.feeAccountID = feeAccountID
+	}
+}
+
 type tccService struct {
 	db *gorm.DB
 }
@@ -51,10 +89,14 @@ func NewTCCService(db *gorm.DB) TCC {
 /**
  * Try will make sure sender have enough balance to go out, and receiver have enough space to take this amount
  * */
-func (s *tccService) Try(ctx context.Context, transactionID string, sourceAccountID, destinationAccountID int, amount int64) error {
+func (s *tccService) Try(ctx context.Context, transactionID string, sourceAccountID, destinationAccountID int, amount int64, opts ...TryOption) error {
 	var (
-		logger = log.GetSugger()
+		logger  = log.GetSugger()
+		options tryOptions
 	)
+	for _, opt := range opts {
+		opt(&options)
+	}
 	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// check if transaction is already tried
 		fundMovement, err := selectFundmovementForUpdate(tx, transactionID)
@@ -65,11 +107,38 @@ func (s *tccService) Try(ctx context.Context, transactionID string, sourceAccoun
 			if err != nil {
 				return err
 			}
-			// lock source's amount
-			err = sourceAcc.TryTransfer(tx, amount)
+			// only same currency accounts can transfer to each other
+			if sourceAcc.Currency != destAcc.Currency {
+				return ErrCurrencyMismatch
+			}
+			if err := checkAccountStatus(sourceAcc, destAcc); err != nil {
+				return err
+			}
+			// source account is locked, so concurrent tries from the same account can not bypass the limits
+			if !options.skipTransferLimits {
+				if err := checkTransferLimits(tx, sourceAcc, amount); err != nil {
+					return err
+				}
+			}
+			var feeAcc *Account
+			if options.fee > 0 {
+				if feeAcc, err = loadFeeAccount(tx, options.feeAccountID, sourceAcc, destAcc); err != nil {
+					return err
+				}
+			}
+			total, err := utils.SafeAdd(amount, options.fee)
+			if err != nil {
+				return err
+			}
+			// lock source's amount and fee
+			err = sourceAcc.TryTransfer(tx, total)
 			if err != nil {
 				if err == utils.ErrNegativeValue {
 					err = ErrInsufficientBalance
+					// the amount itself goes beyond the credit line, a transfer failing only by its fee is short of balance
+					if sourceAcc.ExceedsCreditLimit(amount) {
+						err = ErrCreditLimitExceeded
+					}
 				}
 				return err
 			}
@@ -82,8 +151,16 @@ func (s *tccService) Try(ctx context.Context, transactionID string, sourceAccoun
 				SourceAccountID:      sourceAccountID,
 				DestinationAccountID: destinationAccountID,
 				Amount:               amount,
+				Currency:             sourceAcc.Currency,
 				Stage:                Tried,
 			}
+			// lock fee account's income
+			if feeAcc != nil {
+				if err := feeAcc.TryReceive(tx, options.fee); err != nil {
+					return err
+				}
+				tried.Fee, tried.FeeAccountID = options.fee, feeAcc.AccountID
+			}
 			// Create deduct fund movement.
 			if err := tx.Model(FundMovement{}).Create(&tried).Error; err != nil {
 				// race condition, other goroutine created it between last check and start transaction
@@ -93,8 +170,14 @@ func (s *tccService) Try(ctx context.Context, transactionID string, sourceAccoun
 				}
 				return ErrFailedToWritePayment
 			}
+			if err := writeLedger(tx, NewTryJournal(tried)); err != nil {
+				return err
+			}
+			if err := writeOutbox(tx, transactionID, Tried); err != nil {
+				return err
+			}
 
-			logger.Info("try transaction success", "transactionID", transactionID, "amount", amount)
+			logger.Info("try transaction success", "transactionID", transactionID, "amount", amount, "fee", options.fee)
 			return nil
 		}
 
@@ -151,7 +234,7 @@ func (s *tccService) Confirm(ctx context.Context, transactionID string) error {
 			return err
 		}
 		// confirm from source
-		if err := sourceAcc.Transfer(tx, tried.Amount); err != nil {
+		if err := sourceAcc.Transfer(tx, tried.AmountOf(tried.SourceAccountID)); err != nil {
 			return err
 		}
 
@@ -160,11 +243,25 @@ func (s *tccService) Confirm(ctx context.Context, transactionID string) error {
 			return err
 		}
 
+		// confirm fee
+		if tried.Fee > 0 {
+			feeAcc, err := selectAccountForUpdate(tx, tried.FeeAccountID)
+			if err != nil {
+				return err
+			}
+			if err := feeAcc.Recieve(tx, tried.Fee); err != nil {
+				return err
+			}
+		}
+
 		// update func movement
 		if err = tx.Model(FundMovement{}).Where("transaction_id = ?", tried.TransactionID).Update("stage", Confirmed).Error; err != nil {
 			return ErrFMFailedToMoveDestConfirmed
 		}
-		return nil
+		if err := writeLedger(tx, NewConfirmJournal(*tried)); err != nil {
+			return err
+		}
+		return writeOutbox(tx, tried.TransactionID, Confirmed)
 	})
 }
 
@@ -197,6 +294,9 @@ func (s *tccService) Cancel(ctx context.Context, transactionID string) error {
 			if err != nil {
 				return err
 			}
+			if err := writeOutbox(tx, transactionID, Canceled); err != nil {
+				return err
+			}
 			globalErr = ErrEmptyRollback
 			return nil
 		}
@@ -221,7 +321,7 @@ func (s *tccService) Cancel(ctx context.Context, transactionID string) error {
 			return err
 		}
 
-		if err := sourceAcc.CancelTransfer(tx, tried.Amount); err != nil {
+		if err := sourceAcc.CancelTransfer(tx, tried.AmountOf(tried.SourceAccountID)); err != nil {
 			return err
 		}
 
@@ -229,12 +329,25 @@ func (s *tccService) Cancel(ctx context.Context, transactionID string) error {
 			return err
 		}
 
+		if tried.Fee > 0 {
+			feeAcc, err := selectAccountForUpdate(tx, tried.FeeAccountID)
+			if err != nil {
+				return err
+			}
+			if err := feeAcc.CancelRecieve(tx, tried.Fee); err != nil {
+				return err
+			}
+		}
+
 		// Create refund fund movement
 		if err := tx.Model(FundMovement{}).Where("transaction_id = ?", tried.TransactionID).Update("stage", Canceled).Error; err != nil {
 			return ErrFailedToRollback
 		}
 
-		return nil
+		if err := writeLedger(tx, NewCancelJournal(*tried)); err != nil {
+			return err
+		}
+		return writeOutbox(tx, tried.TransactionID, Canceled)
 	})
 	// Empty rollback
 	if txErr == nil && globalErr != nil {
@@ -243,6 +356,24 @@ func (s *tccService) Cancel(ctx context.Context, transactionID string) error {
 	return txErr
 }
 
+// writeLedger appends the journal to ledger, it must be called in the same db transaction as the balance changes
+func writeLedger(tx *gorm.DB, entries []LedgerEntry) error {
+	if err := tx.Create(&entries).Error; err != nil {
+		log.GetSugger().Error("failed to write ledger", "entries", entries, "err", err)
+		return ErrFailedToWriteLedger
+	}
+	return nil
+}
+
+// writeOutbox records the stage change of fund movement for outbox relay, it must be called in the same db transaction as the change
+func writeOutbox(tx *gorm.DB, transactionID string, stage FundMovementStage) error {
+	if err := tx.Create(&OutboxEvent{TransactionID: transactionID, Stage: stage}).Error; err != nil {
+		log.GetSugger().Error("failed to write outbox", "transactionID", transactionID, "stage", stage, "err", err)
+		return ErrFailedToWriteOutbox
+	}
+	return nil
+}
+
 func selectFundmovementForUpdate(tx *gorm.DB, transactionID string) (*model.FundMovement, error) {
 	var fundMovement FundMovement
 	if err := tx.Model(FundMovement{}).Clauses(clause.Locking{Strength: "Update"}).First(&fundMovement, FundMovement{TransactionID: transactionID}).Error; err != nil {
@@ -251,18 +382,115 @@ func selectFundmovementForUpdate(tx *gorm.DB, transactionID string) (*model.Fund
 	return &fundMovement, nil
 }
 
+// checkAccountStatus makes sure frozen or closed account can not send fund out, and closed account can not receive fund.
+func checkAccountStatus(sourceAcc, destAcc *Account) error {
+	switch sourceAcc.Status {
+	case AccountFrozen:
+		return ErrSourceAccountFrozen
+	case AccountClosed:
+		return ErrSourceAccountClosed
+	}
+	if destAcc.Status == AccountClosed {
+		return ErrDestinationAccountClosed
+	}
+	return nil
+}
+
+// checkTransferLimits checks the amount against source account's single, daily and monthly limits.
+// Both tried and confirmed fund movements are counted into daily and monthly amount. Limits cover transfer amounts only,
+// fees are not counted, and days and months start at 00:00 UTC.
+func checkTransferLimits(tx *gorm.DB, sourceAcc *Account, amount int64) error {
+	if sourceAcc.MaxSingleAmount > 0 && amount > sourceAcc.MaxSingleAmount {
+		return ErrExceedingMaxAmount
+	}
+
+	now := time.Now()
+	limits := []struct {
+		limit int64
+		since time.Time
+		err   error
+	}{
+		{sourceAcc.DailyLimit, startOfDay(now), ErrExceedingDailyLimit},
+		{sourceAcc.MonthlyLimit, startOfMonth(now), ErrExceedingMonthlyLimit},
+	}
+	for _, l := range limits {
+		if l.limit <= 0 {
+			continue
+		}
+		used, err := sumOutgoingAmount(tx, sourceAcc.AccountID, l.since)
+		if err != nil {
+			return err
+		}
+		total, err := utils.SafeAdd(used, amount)
+		if err != nil || total > l.limit {
+			return l.err
+		}
+	}
+	return nil
+}
+
+// sumOutgoingAmount sums the amount of tried and confirmed fund movements sent from the account since the given time, excluding their fees.
+func sumOutgoingAmount(tx *gorm.DB, accountID int, since time.Time) (int64, error) {
+	var sum int64
+	if err := tx.Model(FundMovement{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("source_account_id = ?", accountID).
+		Where("stage IN ?", []FundMovementStage{Tried, Confirmed}).
+		Where("created_at >= ?", since).
+		Scan(&sum).Error; err != nil {
+		return 0, err
+	}
+	return sum, nil
+}
+
+// startOfDay returns the start of the UTC day, so the daily limit does not depend on the server's time zone
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// startOfMonth returns the start of the UTC month
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
 func loadAccounts(tx *gorm.DB, sourceID, destID int) (*Account, *Account, error) {
-	var (
-		sourceAcc Account
-		destAcc   Account
-		err       error
-	)
-	if err = tx.Model(Account{}).Clauses(clause.Locking{Strength: "Update"}).First(&sourceAcc, Account{AccountID: sourceID}).Error; err != nil {
+	sourceAcc, err := selectAccountForUpdate(tx, sourceID)
+	if err != nil {
 		return nil, nil, err
 	}
-	if err = tx.Model(Account{}).Clauses(clause.Locking{Strength: "Update"}).First(&destAcc, Account{AccountID: destID}).Error; err != nil {
+	destAcc, err := selectAccountForUpdate(tx, destID)
+	if err != nil {
 		return nil, nil, err
 	}
 
-	return &sourceAcc, &destAcc, nil
+	return sourceAcc, destAcc, nil
+}
+
+// loadFeeAccount locks the fee account after source and destination. Fee account can not be one side of the transfer,
+// otherwise its balances would be updated twice from the same stale row.
+func loadFeeAccount(tx *gorm.DB, feeAccountID int, sourceAcc, destAcc *Account) (*Account, error) {
+	if feeAccountID == sourceAcc.AccountID || feeAccountID == destAcc.AccountID {
+		return nil, ErrInvalidFeeAccount
+	}
+	feeAcc, err := selectAccountForUpdate(tx, feeAccountID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrInvalidFeeAccount
+		}
+		return nil, err
+	}
+	if feeAcc.Currency != sourceAcc.Currency || feeAcc.Status == AccountClosed {
+		return nil, ErrInvalidFeeAccount
+	}
+	return feeAcc, nil
+}
+
+func selectAccountForUpdate(tx *gorm.DB, accountID int) (*Account, error) {
+	var acc Account
+	if err := tx.Model(Account{}).Clauses(clause.Locking{Strength: "Update"}).First(&acc, Account{AccountID: accountID}).Error; err != nil {
+		return nil, err
+	}
+	return &acc, nil
 }
@@ -2,8 +2,10 @@ package account
 
 import (
 	"context"
+	"fmt"
 	"main/common/db/testutils"
 	"testing"
+	"time"
 
 	. "main/model"
 
@@ -23,6 +25,8 @@ func (s *tccSuite) SetupTest() {
 	s.mockDB, _ = testutils.SetupTestDB()
 	_ = s.mockDB.AutoMigrate(FundMovement{})
 	_ = s.mockDB.AutoMigrate(Account{})
+	_ = s.mockDB.AutoMigrate(LedgerEntry{})
+	_ = s.mockDB.AutoMigrate(OutboxEvent{})
 	s.repository = NewRepository(s.mockDB)
 
 	s.defaultAccounts = []Account{
@@ -41,6 +45,8 @@ func (s *tccSuite) SetupTest() {
 func (s *tccSuite) TearDownTest() {
 	s.mockDB.Exec("DELETE FROM account_tab")
 	s.mockDB.Exec("DELETE FROM fund_movement_tab")
+	s.mockDB.Exec("DELETE FROM ledger_entry_tab")
+	s.mockDB.Exec("DELETE FROM outbox_tab")
 
 }
 
@@ -100,6 +106,150 @@ func (s *tccSuite) Test_Try_Insufficient_Should_ReturnError() {
 	assert.EqualError(s.T(), ErrInsufficientBalance, err.Error())
 }
 
+func (s *tccSuite) Test_Try_CurrencyMismatch_Should_ReturnError() {
+	var (
+		tcc = NewTCCService(s.mockDB)
+		ctx = context.Background()
+		trx = Transaction{
+			TransactionID:        "123",
+			SourceAccountID:      1,
+			DestinationAccountID: 3,
+			Amount:               100,
+		}
+		err error
+	)
+	s.prepareAccounts([]Account{
+		{
+			AccountID: 3,
+			Balance:   100000000,
+			Currency:  "USD",
+		},
+	})
+
+	err = tcc.Try(ctx, trx.TransactionID, trx.SourceAccountID, trx.DestinationAccountID, trx.Amount)
+	assert.EqualError(s.T(), ErrCurrencyMismatch, err.Error())
+
+	_, err = s.repository.GetFundMovement(ctx, FundMovement{
+		TransactionID: trx.TransactionID,
+	})
+	assert.EqualError(s.T(), gorm.ErrRecordNotFound, err.Error())
+}
+
+func (s *tccSuite) Test_Try_InactiveAccounts_Should_ReturnError() {
+	var (
+		tcc = NewTCCService(s.mockDB)
+		ctx = context.Background()
+		err error
+	)
+	s.prepareAccounts([]Account{
+		{
+			AccountID: 3,
+			Balance:   100000000,
+			Status:    AccountFrozen,
+		},
+		{
+			AccountID: 4,
+			Status:    AccountClosed,
+		},
+	})
+
+	err = tcc.Try(ctx, "123", 3, 1, 100)
+	assert.EqualError(s.T(), ErrSourceAccountFrozen, err.Error())
+	err = tcc.Try(ctx, "124", 4, 1, 100)
+	assert.EqualError(s.T(), ErrSourceAccountClosed, err.Error())
+	err = tcc.Try(ctx, "125", 1, 4, 100)
+	assert.EqualError(s.T(), ErrDestinationAccountClosed, err.Error())
+
+	// frozen account can still receive fund
+	err = tcc.Try(ctx, "126", 1, 3, 100)
+	assert.NoError(s.T(), err)
+}
+
+func (s *tccSuite) Test_Try_ExceedingLimits_Should_ReturnError() {
+	var (
+		tcc = NewTCCService(s.mockDB)
+		ctx = context.Background()
+		err error
+	)
+	s.prepareAccounts([]Account{
+		{
+			AccountID:       3,
+			Balance:         100000000,
+			MaxSingleAmount: 500,
+			DailyLimit:      800,
+			MonthlyLimit:    1000,
+		},
+	})
+
+	err = tcc.Try(ctx, "123", 3, 1, 501)
+	assert.EqualError(s.T(), ErrExceedingMaxAmount, err.Error())
+
+	err = tcc.Try(ctx, "124", 3, 1, 500)
+	assert.NoError(s.T(), err)
+	err = tcc.Try(ctx, "125", 3, 1, 301)
+	assert.EqualError(s.T(), ErrExceedingDailyLimit, err.Error())
+
+	// confirmed amount is still counted, canceled amount is released
+	err = tcc.Confirm(ctx, "124")
+	assert.NoError(s.T(), err)
+	err = tcc.Try(ctx, "126", 3, 1, 300)
+	assert.NoError(s.T(), err)
+	err = tcc.Cancel(ctx, "126")
+	assert.NoError(s.T(), err)
+	err = tcc.Try(ctx, "127", 3, 1, 300)
+	assert.NoError(s.T(), err)
+
+	// move used amount to last day, only monthly limit applies
+	s.mockDB.Model(FundMovement{}).Where("source_account_id = ?", 3).Update("created_at", startOfDay(time.Now()).Add(-time.Second))
+	if startOfMonth(time.Now()).Before(startOfDay(time.Now())) {
+		err = tcc.Try(ctx, "128", 3, 1, 201)
+		assert.EqualError(s.T(), ErrExceedingMonthlyLimit, err.Error())
+		err = tcc.Try(ctx, "129", 3, 1, 200)
+		assert.NoError(s.T(), err)
+	}
+}
+
+func (s *tccSuite) Test_LimitPeriods_ShouldStartAtUTC() {
+	// 2024-03-01 01:00 at UTC+8 is still 2024-02-29 in UTC
+	at := time.Date(2024, 3, 1, 1, 0, 0, 0, time.FixedZone("UTC+8", 8*60*60))
+	assert.Equal(s.T(), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), startOfDay(at))
+	assert.Equal(s.T(), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), startOfMonth(at))
+}
+
+func (s *tccSuite) Test_Try_CreditLine() {
+	var (
+		tcc = NewTCCService(s.mockDB)
+		ctx = context.Background()
+		err error
+	)
+	s.prepareAccounts([]Account{
+		{
+			AccountID:   3,
+			Balance:     100,
+			CreditLimit: 500,
+		},
+	})
+
+	err = tcc.Try(ctx, "123", 3, 1, 601)
+	assert.EqualError(s.T(), ErrCreditLimitExceeded, err.Error())
+
+	err = tcc.Try(ctx, "124", 3, 1, 400)
+	assert.NoError(s.T(), err)
+	err = tcc.Try(ctx, "125", 3, 1, 201)
+	assert.EqualError(s.T(), ErrCreditLimitExceeded, err.Error())
+	err = tcc.Confirm(ctx, "124")
+	assert.NoError(s.T(), err)
+	err = tcc.Try(ctx, "126", 3, 1, 200)
+	assert.NoError(s.T(), err)
+	err = tcc.Confirm(ctx, "126")
+	assert.NoError(s.T(), err)
+
+	acc, err := s.repository.GetAccountByID(ctx, 3)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(-500), acc.Balance)
+	assert.Equal(s.T(), int64(500), acc.CreditUsed())
+}
+
 func (s *tccSuite) Test_Confirm_MultipleCall_Should_OnlyProceedOnce_ReturnOK() {
 	var (
 		tcc = NewTCCService(s.mockDB)
@@ -313,11 +463,209 @@ func (s *tccSuite) Test_Cancel_Try() {
 	s.validateAccounts(ctx, s.defaultAccounts)
 }
 
+func (s *tccSuite) Test_QueryStatement_RunningBalance() {
+	var (
+		tcc     = NewTCCService(s.mockDB)
+		service = &accountService{repo: s.repository}
+		ctx     = context.Background()
+		err     error
+	)
+	// 1 -> 2: 100, 2 -> 1: 30, 1 -> 2: 50, 1 -> 2: 10 tried only, 1 -> 2: 20 canceled
+	for _, trx := range []Transaction{
+		{TransactionID: "1", SourceAccountID: 1, DestinationAccountID: 2, Amount: 100},
+		{TransactionID: "2", SourceAccountID: 2, DestinationAccountID: 1, Amount: 30},
+		{TransactionID: "3", SourceAccountID: 1, DestinationAccountID: 2, Amount: 50},
+	} {
+		err = tcc.Try(ctx, trx.TransactionID, trx.SourceAccountID, trx.DestinationAccountID, trx.Amount)
+		assert.NoError(s.T(), err)
+		err = tcc.Confirm(ctx, trx.TransactionID)
+		assert.NoError(s.T(), err)
+	}
+	_ = tcc.Try(ctx, "4", 1, 2, 10)
+	_ = tcc.Try(ctx, "5", 1, 2, 20)
+	_ = tcc.Cancel(ctx, "5")
+
+	entries, cursor, err := service.QueryStatement(ctx, StatementRequest{AccountID: 1, Limit: 2})
+	assert.NoError(s.T(), err)
+	assert.NotEmpty(s.T(), cursor)
+	assert.Len(s.T(), entries, 2)
+	assert.Equal(s.T(), "3", entries[0].TransactionID)
+	assert.Equal(s.T(), int64(99999880), entries[0].BalanceAfter)
+	assert.Equal(s.T(), "2", entries[1].TransactionID)
+	assert.Equal(s.T(), int64(99999930), entries[1].BalanceAfter)
+
+	entries, cursor, err = service.QueryStatement(ctx, StatementRequest{AccountID: 1, Limit: 2, Cursor: cursor})
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), cursor)
+	assert.Len(s.T(), entries, 1)
+	assert.Equal(s.T(), "1", entries[0].TransactionID)
+	assert.Equal(s.T(), int64(99999900), entries[0].BalanceAfter)
+
+	entries, _, err = service.QueryStatement(ctx, StatementRequest{AccountID: 2, To: time.Now().Add(-time.Hour)})
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), entries)
+
+	_, _, err = service.QueryStatement(ctx, StatementRequest{AccountID: 1, Cursor: "invalid"})
+	assert.Error(s.T(), err)
+}
+
+func (s *tccSuite) Test_QueryHolds() {
+	var (
+		tcc     = NewTCCService(s.mockDB)
+		service = &accountService{repo: s.repository}
+		ctx     = context.Background()
+	)
+	assert.NoError(s.T(), tcc.Try(ctx, "1", 1, 2, 100))
+	assert.NoError(s.T(), tcc.Try(ctx, "2", 2, 1, 30))
+	assert.NoError(s.T(), tcc.Try(ctx, "3", 1, 2, 50))
+	assert.NoError(s.T(), tcc.Confirm(ctx, "3"))
+
+	holds, err := service.QueryHolds(ctx, QueryAccountRequest{AccountID: 1})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), holds, 2)
+	assert.Equal(s.T(), "1", holds[0].TransactionID)
+	assert.Equal(s.T(), "2", holds[1].TransactionID)
+
+	acc, err := s.repository.GetAccountByID(ctx, 1)
+	assert.NoError(s.T(), err)
+	resp := newQueryResponse(acc)
+	assert.Equal(s.T(), "99.999950", resp.Balance)
+	assert.Equal(s.T(), "99.999850", resp.AvailableBalance)
+	assert.Equal(s.T(), "0.000030", resp.PendingIn)
+	assert.Equal(s.T(), "0.000100", resp.PendingOut)
+
+	_, err = service.QueryHolds(ctx, QueryAccountRequest{AccountID: 100})
+	assert.EqualError(s.T(), gorm.ErrRecordNotFound, err.Error())
+}
+
+func (s *tccSuite) Test_Ledger_ReconcileWithAccounts() {
+	var (
+		tcc     = NewTCCService(s.mockDB)
+		service = &accountService{repo: s.repository}
+		ctx     = context.Background()
+		err     error
+	)
+	assert.NoError(s.T(), s.repository.CreateAccount(ctx, &Account{AccountID: 10, Balance: 1000}))
+	assert.NoError(s.T(), s.repository.CreateAccount(ctx, &Account{AccountID: 11}))
+
+	assert.NoError(s.T(), tcc.Try(ctx, "1", 10, 11, 100))
+	assert.NoError(s.T(), tcc.Confirm(ctx, "1"))
+	assert.NoError(s.T(), tcc.Try(ctx, "2", 11, 10, 30))
+	assert.NoError(s.T(), tcc.Cancel(ctx, "2"))
+	assert.NoError(s.T(), tcc.Try(ctx, "3", 10, 11, 50))
+
+	for _, accountID := range []uint64{10, 11} {
+		acc, ledger, err := service.ReconcileAccount(ctx, QueryAccountRequest{AccountID: accountID})
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), acc.Balance, ledger.Balance)
+		assert.Equal(s.T(), acc.InBalance, ledger.InBalance)
+		assert.Equal(s.T(), acc.OutBalance, ledger.OutBalance)
+	}
+	acc, _, err := service.ReconcileAccount(ctx, QueryAccountRequest{AccountID: 10})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(900), acc.Balance)
+	assert.Equal(s.T(), int64(50), acc.OutBalance)
+
+	// every journal is balanced
+	var unbalanced int64
+	err = s.mockDB.Model(LedgerEntry{}).
+		Select("transaction_id, phase").
+		Group("transaction_id, phase").
+		Having("SUM(CASE WHEN direction = ? THEN amount ELSE -amount END) <> 0", Debit).
+		Count(&unbalanced).Error
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(0), unbalanced)
+}
+
+func (s *tccSuite) Test_TryWithFee_ShouldHoldAndConfirmFeeTogether() {
+	var (
+		tcc     = NewTCCService(s.mockDB)
+		service = &accountService{repo: s.repository}
+		ctx     = context.Background()
+	)
+	assert.NoError(s.T(), s.repository.CreateAccount(ctx, &Account{AccountID: 10, Balance: 1000}))
+	assert.NoError(s.T(), s.repository.CreateAccount(ctx, &Account{AccountID: 11}))
+	assert.NoError(s.T(), s.repository.CreateAccount(ctx, &Account{AccountID: 99}))
+
+	// fee is checked against balance together with amount
+	assert.ErrorIs(s.T(), tcc.Try(ctx, "1", 10, 11, 1000, WithFee(99, 1)), ErrInsufficientBalance)
+	// within the credit line, a transfer failing only by its fee is short of balance
+	assert.NoError(s.T(), s.repository.CreateAccount(ctx, &Account{AccountID: 12, Balance: 100, CreditLimit: 100}))
+	assert.ErrorIs(s.T(), tcc.Try(ctx, "5", 12, 11, 200, WithFee(99, 1)), ErrInsufficientBalance)
+	assert.ErrorIs(s.T(), tcc.Try(ctx, "6", 12, 11, 201, WithFee(99, 1)), ErrCreditLimitExceeded)
+	// fee account can not be one side of the transfer
+	assert.ErrorIs(s.T(), tcc.Try(ctx, "2", 10, 11, 100, WithFee(11, 1)), ErrInvalidFeeAccount)
+	assert.ErrorIs(s.T(), tcc.Try(ctx, "3", 10, 11, 100, WithFee(100, 1)), ErrInvalidFeeAccount)
+
+	assert.NoError(s.T(), tcc.Try(ctx, "4", 10, 11, 100, WithFee(99, 5)))
+	acc, _ := s.repository.GetAccountByID(ctx, 10)
+	assert.Equal(s.T(), int64(105), acc.OutBalance)
+	acc, _ = s.repository.GetAccountByID(ctx, 99)
+	assert.Equal(s.T(), int64(5), acc.InBalance)
+	assert.NoError(s.T(), tcc.Confirm(ctx, "4"))
+
+	assert.NoError(s.T(), tcc.Try(ctx, "5", 10, 11, 100, WithFee(99, 5)))
+	assert.NoError(s.T(), tcc.Cancel(ctx, "5"))
+
+	s.validateAccounts(ctx, []Account{
+		{AccountID: 10, Balance: 895},
+		{AccountID: 11, Balance: 100},
+		{AccountID: 99, Balance: 5},
+	})
+	for _, accountID := range []uint64{10, 11, 99} {
+		acc, ledger, err := service.ReconcileAccount(ctx, QueryAccountRequest{AccountID: accountID})
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), acc.Balance, ledger.Balance)
+		assert.Equal(s.T(), int64(0), acc.InBalance)
+		assert.Equal(s.T(), int64(0), acc.OutBalance)
+	}
+
+	entries, err := s.repository.QueryStatement(ctx, StatementQuery{AccountID: 10, Limit: 10})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), entries, 1)
+	assert.Equal(s.T(), int64(105), entries[0].AmountOf(10))
+	assert.Equal(s.T(), int64(895), entries[0].BalanceAfter)
+	entries, err = s.repository.QueryStatement(ctx, StatementQuery{AccountID: 99, Limit: 10})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), entries, 1)
+	assert.Equal(s.T(), int64(5), entries[0].BalanceAfter)
+}
+
+func (s *tccSuite) Test_StageChanges_ShouldWriteOutbox() {
+	var (
+		tcc = NewTCCService(s.mockDB)
+		ctx = context.Background()
+	)
+
+	assert.NoError(s.T(), tcc.Try(ctx, "confirmed", 1, 2, 100))
+	assert.NoError(s.T(), tcc.Confirm(ctx, "confirmed"))
+	assert.NoError(s.T(), tcc.Confirm(ctx, "confirmed"))
+	assert.NoError(s.T(), tcc.Try(ctx, "canceled", 1, 2, 100))
+	assert.NoError(s.T(), tcc.Cancel(ctx, "canceled"))
+	assert.ErrorIs(s.T(), tcc.Cancel(ctx, "empty"), ErrEmptyRollback)
+	// rejected try changes nothing
+	assert.ErrorIs(s.T(), tcc.Try(ctx, "empty", 1, 2, 100), ErrRollbacked)
+
+	events, err := s.repository.QueryOutboxEvents(ctx, 10)
+	assert.NoError(s.T(), err)
+	stages := make([]string, 0, len(events))
+	for _, event := range events {
+		stages = append(stages, fmt.Sprintf("%s:%d", event.TransactionID, event.Stage))
+	}
+	assert.Equal(s.T(), []string{"confirmed:1", "confirmed:2", "canceled:1", "canceled:3", "empty:3"}, stages)
+
+	assert.NoError(s.T(), s.repository.MarkOutboxEventRelayed(ctx, events[0].ID, time.Now()))
+	events, err = s.repository.QueryOutboxEvents(ctx, 10)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), events, 4)
+}
+
 func (s *tccSuite) validateFundMovement(fm *FundMovement, trx Transaction, stage FundMovementStage) {
 	assert.Equal(s.T(), trx.TransactionID, fm.TransactionID, "transaction_id not match")
 	assert.Equal(s.T(), trx.SourceAccountID, fm.SourceAccountID, "source_id not match")
 	assert.Equal(s.T(), trx.Amount, fm.Amount, "acount not match")
 	assert.Equal(s.T(), stage, fm.Stage, "stage not match")
+	assert.Equal(s.T(), DefaultCurrency, fm.Currency, "currency not match")
 }
 
 func (s *tccSuite) validateAccounts(ctx context.Context, expectAccountStatus []Account) {
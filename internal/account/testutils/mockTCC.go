@@ -22,11 +22,11 @@ func (s *mockTCC) SetTimeout(try, confirm, cancel bool) {
 	s.canceltimeout = cancel
 }
 
-func (s *mockTCC) Try(ctx context.Context, transactionID string, sourceAccountID, destinationAccountID int, amount int64) error {
+func (s *mockTCC) Try(ctx context.Context, transactionID string, sourceAccountID, destinationAccountID int, amount int64, opts ...account.TryOption) error {
 	if s.tryTimeout {
 		return context.DeadlineExceeded
 	}
-	return s.tcc.Try(ctx, transactionID, sourceAccountID, destinationAccountID, amount)
+	return s.tcc.Try(ctx, transactionID, sourceAccountID, destinationAccountID, amount, opts...)
 }
 
 func (s *mockTCC) Confirm(ctx context.Context, transactionID string) error {
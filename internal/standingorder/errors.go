@@ -0,0 +1,119 @@
+package standingorder
+
+import (
+	"errors"
+	"main/common/response"
+	"main/common/utils"
+	"main/internal/account"
+	"main/internal/transaction"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errInvalidRequest = errors.New("invalid request")
+
+	ErrInvalidSchedule      = errors.New("invalid schedule")
+	ErrInvalidFailurePolicy = errors.New("invalid failure policy")
+	ErrInvalidEndAt         = errors.New("invalid end at")
+	// ErrStandingOrderNotActive indicates pausing a standing order which is not active
+	ErrStandingOrderNotActive = errors.New("standing order not active")
+	// ErrStandingOrderNotPaused indicates resuming a standing order which is not paused
+	ErrStandingOrderNotPaused = errors.New("standing order not paused")
+	// ErrStandingOrderFinished indicates changing a completed or canceled standing order
+	ErrStandingOrderFinished = errors.New("standing order finished")
+)
+
+var createHandlerErrors = map[error]*response.ExternalResponse{
+	errInvalidRequest: {
+		Code:    400,
+		Message: "Invalid Request",
+	},
+	ErrInvalidSchedule: {
+		Code:    400,
+		Message: "Invalid Schedule",
+	},
+	ErrInvalidFailurePolicy: {
+		Code:    400,
+		Message: "Invalid Failure Policy",
+	},
+	ErrInvalidEndAt: {
+		Code:    400,
+		Message: "End At Must Be After Start At",
+	},
+	transaction.ErrSameAccountTransactions: {
+		Code:    400,
+		Message: "Transfer to Same Account is Not Allowed",
+	},
+	transaction.ErrInvalidSender: {
+		Code:    400,
+		Message: "Sender ID Not Found",
+	},
+	transaction.ErrInvalidReciever: {
+		Code:    400,
+		Message: "Reciever ID Not Found",
+	},
+	transaction.ErrInvalidAmount: {
+		Code:    400,
+		Message: "Amount Must Be Greater Than Zero",
+	},
+	transaction.ErrClearingAccountNotAllowed: {
+		Code:    400,
+		Message: "Clearing Account Is Not Allowed",
+	},
+	account.ErrCurrencyMismatch: {
+		Code:    400,
+		Message: "Currency Mismatch Between Accounts",
+	},
+	utils.ErrNegativeValue: {
+		Code:    400,
+		Message: "Amount Can Not Be Negative",
+	},
+	utils.ErrOverflow: {
+		Code:    400,
+		Message: "Amount Overflow",
+	},
+	utils.ErrTooManyDigits: {
+		Code:    400,
+		Message: "Too Many Digits, We Only Support 6 Digits Most",
+	},
+}
+
+var queryHandlerErrors = map[error]*response.ExternalResponse{
+	errInvalidRequest: {
+		Code:    400,
+		Message: "Invalid Request",
+	},
+	gorm.ErrRecordNotFound: {
+		Code:    404,
+		Message: "Standing Order Not Found",
+	},
+}
+
+// updateHandlerErrors adds errors of changing an existing standing order on top of createHandlerErrors
+var updateHandlerErrors = func() map[error]*response.ExternalResponse {
+	mapping := map[error]*response.ExternalResponse{
+		gorm.ErrRecordNotFound: {
+			Code:    404,
+			Message: "Standing Order Not Found",
+		},
+		ErrStandingOrderNotActive: {
+			Code:    409,
+			Message: "Standing Order Is Not Active",
+		},
+		ErrStandingOrderNotPaused: {
+			Code:    409,
+			Message: "Standing Order Is Not Paused",
+		},
+		ErrStandingOrderFinished: {
+			Code:    409,
+			Message: "Standing Order Is Completed Or Canceled",
+		},
+	}
+	for err, resp := range createHandlerErrors {
+		if _, ok := mapping[err]; !ok {
+			mapping[err] = resp
+		}
+	}
+	return mapping
+}()
@@ -0,0 +1,188 @@
+package standingorder
+
+import (
+	"context"
+	"main/common/response"
+	"main/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) CreateStandingOrder(c *gin.Context) {
+	var (
+		req         CreateStandingOrderRequest
+		returnError *error
+		order       model.StandingOrder
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, createHandlerErrors)
+			return
+		}
+		(&order).FormatForDisplay()
+		response.Ok(c, order)
+	}()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	order, err := h.service.CreateStandingOrder(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) QueryStandingOrder(c *gin.Context) {
+	var (
+		req         QueryStandingOrderRequest
+		returnError *error
+		order       model.StandingOrder
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, queryHandlerErrors)
+			return
+		}
+		(&order).FormatForDisplay()
+		response.Ok(c, order)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	order, err := h.service.QueryStandingOrder(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) ListStandingOrders(c *gin.Context) {
+	var (
+		req         ListStandingOrdersRequest
+		returnError *error
+		orders      []model.StandingOrder
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, queryHandlerErrors)
+			return
+		}
+		for i := range orders {
+			orders[i].FormatForDisplay()
+		}
+		response.Ok(c, orders)
+	}()
+	if err := c.ShouldBindQuery(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	orders, err := h.service.ListStandingOrders(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) UpdateStandingOrder(c *gin.Context) {
+	var (
+		req         UpdateStandingOrderRequest
+		returnError *error
+		order       model.StandingOrder
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, updateHandlerErrors)
+			return
+		}
+		(&order).FormatForDisplay()
+		response.Ok(c, order)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	order, err := h.service.UpdateStandingOrder(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) PauseStandingOrder(c *gin.Context) {
+	h.updateStatus(c, h.service.PauseStandingOrder)
+}
+
+func (h *Handler) ResumeStandingOrder(c *gin.Context) {
+	h.updateStatus(c, h.service.ResumeStandingOrder)
+}
+
+func (h *Handler) CancelStandingOrder(c *gin.Context) {
+	h.updateStatus(c, h.service.CancelStandingOrder)
+}
+
+func (h *Handler) updateStatus(c *gin.Context, update func(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error)) {
+	var (
+		req         QueryStandingOrderRequest
+		returnError *error
+		order       model.StandingOrder
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, updateHandlerErrors)
+			return
+		}
+		(&order).FormatForDisplay()
+		response.Ok(c, order)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	order, err := update(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) QueryRuns(c *gin.Context) {
+	var (
+		req         QueryRunsRequest
+		returnError *error
+		runs        []model.StandingOrderRun
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, queryHandlerErrors)
+			return
+		}
+		response.Ok(c, runs)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		returnError = &errInvalidRequest
+		return
+	}
+	runs, err := h.service.QueryRuns(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
@@ -0,0 +1,45 @@
+package standingorder
+
+import "time"
+
+const (
+	DefaultRunsLimit = 20
+	MaxRunsLimit     = 100
+)
+
+type CreateStandingOrderRequest struct {
+	SourceAccountID      int    `json:"source_account_id" binding:"required"`
+	DestinationAccountID int    `json:"destination_account_id" binding:"required"`
+	Amount               string `json:"amount" binding:"required"`
+	Currency             string `json:"currency"`
+	// Schedule is @hourly, @daily, @weekly, @monthly or @every <duration>
+	Schedule string `json:"schedule" binding:"required"`
+	// FailurePolicy is skip, retry or pause, default is skip
+	FailurePolicy string `json:"failure_policy"`
+	// StartAt is the first run, default is now
+	StartAt *time.Time `json:"start_at"`
+	// EndAt is optional, no run is executed after it
+	EndAt *time.Time `json:"end_at"`
+}
+
+// UpdateStandingOrderRequest updates the given fields only
+type UpdateStandingOrderRequest struct {
+	StandingOrderID string     `uri:"standing_order_id" json:"-" binding:"required"`
+	Amount          *string    `json:"amount"`
+	Schedule        *string    `json:"schedule"`
+	FailurePolicy   *string    `json:"failure_policy"`
+	EndAt           *time.Time `json:"end_at"`
+}
+
+type QueryStandingOrderRequest struct {
+	StandingOrderID string `uri:"standing_order_id" json:"standing_order_id" binding:"required"`
+}
+
+type ListStandingOrdersRequest struct {
+	SourceAccountID int `form:"source_account_id" binding:"required"`
+}
+
+type QueryRunsRequest struct {
+	StandingOrderID string `uri:"standing_order_id" binding:"required"`
+	Limit           int    `form:"limit"`
+}
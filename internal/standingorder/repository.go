@@ -0,0 +1,113 @@
+package standingorder
+
+import (
+	"context"
+	. "main/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Repository interface {
+	CreateStandingOrder(ctx context.Context, order StandingOrder) error
+	GetStandingOrderByID(ctx context.Context, id string) (StandingOrder, error)
+	ListStandingOrders(ctx context.Context, sourceAccountID int) ([]StandingOrder, error)
+	UpdateStandingOrder(ctx context.Context, id string, update func(order *StandingOrder) error) (StandingOrder, error)
+	QueryDueStandingOrders(ctx context.Context, now time.Time, limit int) ([]StandingOrder, error)
+	ClaimRun(ctx context.Context, id string, now, leaseUntil time.Time) (bool, error)
+	SaveRun(ctx context.Context, run StandingOrderRun, update func(order *StandingOrder) error) (StandingOrder, error)
+	QueryRuns(ctx context.Context, id string, limit int) ([]StandingOrderRun, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+func (r *repository) CreateStandingOrder(ctx context.Context, order StandingOrder) error {
+	return r.db.WithContext(ctx).Create(&order).Error
+}
+
+func (r *repository) GetStandingOrderByID(ctx context.Context, id string) (StandingOrder, error) {
+	var order StandingOrder
+	if err := r.db.WithContext(ctx).Where("standing_order_id = ?", id).First(&order).Error; err != nil {
+		return StandingOrder{}, err
+	}
+	return order, nil
+}
+
+func (r *repository) ListStandingOrders(ctx context.Context, sourceAccountID int) ([]StandingOrder, error) {
+	var orders []StandingOrder
+	if err := r.db.WithContext(ctx).Where("source_account_id = ?", sourceAccountID).Order("id").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// UpdateStandingOrder locks the standing order, and saves it after update. Error of update aborts the change.
+func (r *repository) UpdateStandingOrder(ctx context.Context, id string, update func(order *StandingOrder) error) (StandingOrder, error) {
+	var order StandingOrder
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return updateStandingOrder(tx, id, &order, update)
+	})
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	return order, nil
+}
+
+func updateStandingOrder(tx *gorm.DB, id string, order *StandingOrder, update func(order *StandingOrder) error) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("standing_order_id = ?", id).First(order).Error; err != nil {
+		return err
+	}
+	if err := update(order); err != nil {
+		return err
+	}
+	return tx.Save(order).Error
+}
+
+// QueryDueStandingOrders loads active standing orders whose next run is passed, earliest first
+func (r *repository) QueryDueStandingOrders(ctx context.Context, now time.Time, limit int) ([]StandingOrder, error) {
+	var orders []StandingOrder
+	if err := r.db.WithContext(ctx).Where("status = ? AND next_run_at <= ?", StandingOrderActive, now).Order("next_run_at").Limit(limit).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ClaimRun moves next run of a due standing order to leaseUntil, so it's not executed by others at the same time.
+// If the run is not saved before leaseUntil, it will be executed again.
+func (r *repository) ClaimRun(ctx context.Context, id string, now, leaseUntil time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&StandingOrder{}).
+		Where("standing_order_id = ? AND status = ? AND next_run_at <= ?", id, StandingOrderActive, now).
+		Update("next_run_at", leaseUntil)
+	return result.RowsAffected == 1, result.Error
+}
+
+// SaveRun saves the run, and updates the standing order for its next run in one db transaction
+func (r *repository) SaveRun(ctx context.Context, run StandingOrderRun, update func(order *StandingOrder) error) (StandingOrder, error) {
+	var order StandingOrder
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&run).Error; err != nil {
+			return err
+		}
+		return updateStandingOrder(tx, run.StandingOrderID, &order, update)
+	})
+	if err != nil {
+		return StandingOrder{}, err
+	}
+	return order, nil
+}
+
+// QueryRuns loads latest runs of the standing order, latest first
+func (r *repository) QueryRuns(ctx context.Context, id string, limit int) ([]StandingOrderRun, error) {
+	var runs []StandingOrderRun
+	if err := r.db.WithContext(ctx).Where("standing_order_id = ?", id).Order("id DESC").Limit(limit).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
@@ -0,0 +1,37 @@
+package standingorder
+
+import (
+	"strings"
+	"time"
+)
+
+// MinInterval is the minimum interval of @every schedule
+const MinInterval = time.Minute
+
+// schedule returns the run after the given run
+type schedule func(t time.Time) time.Time
+
+// parseSchedule parses cron-like descriptors:
+//   - @hourly, @daily, @weekly, @monthly
+//   - @every <duration>, like @every 36h. Duration is at least MinInterval
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		return func(t time.Time) time.Time { return t.Add(time.Hour) }, nil
+	case "@daily":
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }, nil
+	case "@weekly":
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }, nil
+	case "@monthly":
+		return func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }, nil
+	}
+	if !strings.HasPrefix(spec, "@every ") {
+		return nil, ErrInvalidSchedule
+	}
+	interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+	if err != nil || interval < MinInterval {
+		return nil, ErrInvalidSchedule
+	}
+	return func(t time.Time) time.Time { return t.Add(interval) }, nil
+}
@@ -0,0 +1,360 @@
+package standingorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/common/config"
+	"main/common/log"
+	"main/common/utils"
+	"main/internal/account"
+	"main/internal/transaction"
+	"main/model"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultRetryIntervalMinutes = 60
+	DefaultMaxRetries           = 3
+	// MaxDueStandingOrdersPerRun limits the standing orders executed by one scheduler run, the rest are executed in next runs
+	MaxDueStandingOrdersPerRun = 200
+	// RunLease is how long a claimed run is hold by the worker executing it
+	RunLease = time.Minute
+	// IdempotencyClientID is the client of the idempotency keys used by standing order runs
+	IdempotencyClientID = "standing-order"
+)
+
+type Service interface {
+	CreateStandingOrder(ctx context.Context, req CreateStandingOrderRequest) (model.StandingOrder, error)
+	QueryStandingOrder(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error)
+	ListStandingOrders(ctx context.Context, req ListStandingOrdersRequest) ([]model.StandingOrder, error)
+	UpdateStandingOrder(ctx context.Context, req UpdateStandingOrderRequest) (model.StandingOrder, error)
+	PauseStandingOrder(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error)
+	ResumeStandingOrder(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error)
+	CancelStandingOrder(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error)
+	QueryRuns(ctx context.Context, req QueryRunsRequest) ([]model.StandingOrderRun, error)
+	RunDueStandingOrders(ctx context.Context, now time.Time) error
+}
+
+type service struct {
+	repo               Repository
+	accountRepo        account.AccountRepository
+	transactionService transaction.Service
+}
+
+func NewService(repo Repository, accountRepo account.AccountRepository, transactionService transaction.Service) Service {
+	return &service{repo: repo, accountRepo: accountRepo, transactionService: transactionService}
+}
+
+func (s *service) CreateStandingOrder(ctx context.Context, req CreateStandingOrderRequest) (model.StandingOrder, error) {
+	if req.SourceAccountID == req.DestinationAccountID {
+		return model.StandingOrder{}, transaction.ErrSameAccountTransactions
+	}
+	inflatedValue, err := transaction.ParseAmount(req.Amount)
+	if err != nil {
+		return model.StandingOrder{}, err
+	}
+	if _, err := parseSchedule(req.Schedule); err != nil {
+		return model.StandingOrder{}, err
+	}
+	policy, err := parseFailurePolicy(req.FailurePolicy)
+	if err != nil {
+		return model.StandingOrder{}, err
+	}
+	startAt := time.Now().UTC()
+	if req.StartAt != nil && req.StartAt.After(startAt) {
+		startAt = req.StartAt.UTC()
+	}
+	if req.EndAt != nil && !req.EndAt.After(startAt) {
+		return model.StandingOrder{}, ErrInvalidEndAt
+	}
+
+	sourceAcc, err := s.loadAccount(ctx, req.SourceAccountID, transaction.ErrInvalidSender)
+	if err != nil {
+		return model.StandingOrder{}, err
+	}
+	destAcc, err := s.loadAccount(ctx, req.DestinationAccountID, transaction.ErrInvalidReciever)
+	if err != nil {
+		return model.StandingOrder{}, err
+	}
+	if sourceAcc.Currency != destAcc.Currency {
+		return model.StandingOrder{}, account.ErrCurrencyMismatch
+	}
+	if req.Currency != "" && !strings.EqualFold(strings.TrimSpace(req.Currency), sourceAcc.Currency) {
+		return model.StandingOrder{}, account.ErrCurrencyMismatch
+	}
+
+	order := model.StandingOrder{
+		StandingOrderID:      utils.GenerateTransactionID(),
+		SourceAccountID:      sourceAcc.AccountID,
+		DestinationAccountID: destAcc.AccountID,
+		Amount:               inflatedValue,
+		Currency:             sourceAcc.Currency,
+		Schedule:             strings.TrimSpace(req.Schedule),
+		FailurePolicy:        policy,
+		Status:               model.StandingOrderActive,
+		ScheduledAt:          startAt,
+		NextRunAt:            startAt,
+		EndAt:                req.EndAt,
+	}
+	if err := s.repo.CreateStandingOrder(ctx, order); err != nil {
+		return model.StandingOrder{}, err
+	}
+	log.GetSugger().Info("standing order created", "standingOrderID", order.StandingOrderID, "schedule", order.Schedule)
+	return s.repo.GetStandingOrderByID(ctx, order.StandingOrderID)
+}
+
+func (s *service) loadAccount(ctx context.Context, accountID int, errNotFound error) (model.Account, error) {
+	acc, err := s.accountRepo.GetAccountByID(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Account{}, errNotFound
+		}
+		return model.Account{}, err
+	}
+	if acc.IsClearing() {
+		return model.Account{}, transaction.ErrClearingAccountNotAllowed
+	}
+	return acc, nil
+}
+
+func (s *service) QueryStandingOrder(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error) {
+	return s.repo.GetStandingOrderByID(ctx, req.StandingOrderID)
+}
+
+func (s *service) ListStandingOrders(ctx context.Context, req ListStandingOrdersRequest) ([]model.StandingOrder, error) {
+	return s.repo.ListStandingOrders(ctx, req.SourceAccountID)
+}
+
+func (s *service) UpdateStandingOrder(ctx context.Context, req UpdateStandingOrderRequest) (model.StandingOrder, error) {
+	var (
+		inflatedValue int64
+		policy        model.FailurePolicy
+		err           error
+	)
+	if req.Amount != nil {
+		if inflatedValue, err = transaction.ParseAmount(*req.Amount); err != nil {
+			return model.StandingOrder{}, err
+		}
+	}
+	if req.Schedule != nil {
+		if _, err := parseSchedule(*req.Schedule); err != nil {
+			return model.StandingOrder{}, err
+		}
+	}
+	if req.FailurePolicy != nil {
+		if policy, err = parseFailurePolicy(*req.FailurePolicy); err != nil {
+			return model.StandingOrder{}, err
+		}
+	}
+
+	return s.repo.UpdateStandingOrder(ctx, req.StandingOrderID, func(order *model.StandingOrder) error {
+		if isFinished(order) {
+			return ErrStandingOrderFinished
+		}
+		if req.Amount != nil {
+			order.Amount = inflatedValue
+		}
+		if req.Schedule != nil {
+			order.Schedule = strings.TrimSpace(*req.Schedule)
+		}
+		if req.FailurePolicy != nil {
+			order.FailurePolicy = policy
+		}
+		if req.EndAt != nil {
+			if !req.EndAt.After(order.ScheduledAt) {
+				return ErrInvalidEndAt
+			}
+			order.EndAt = req.EndAt
+		}
+		return nil
+	})
+}
+
+func (s *service) PauseStandingOrder(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error) {
+	return s.repo.UpdateStandingOrder(ctx, req.StandingOrderID, func(order *model.StandingOrder) error {
+		if order.Status != model.StandingOrderActive {
+			return ErrStandingOrderNotActive
+		}
+		order.Status = model.StandingOrderPaused
+		return nil
+	})
+}
+
+// ResumeStandingOrder activates a paused standing order. Runs missed during pause are skipped.
+func (s *service) ResumeStandingOrder(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error) {
+	return s.repo.UpdateStandingOrder(ctx, req.StandingOrderID, func(order *model.StandingOrder) error {
+		if order.Status != model.StandingOrderPaused {
+			return ErrStandingOrderNotPaused
+		}
+		order.Status = model.StandingOrderActive
+		order.Attempts = 0
+		order.NextRunAt = order.ScheduledAt
+		if now := time.Now().UTC(); order.ScheduledAt.Before(now) {
+			return advance(order, now)
+		}
+		return nil
+	})
+}
+
+func (s *service) CancelStandingOrder(ctx context.Context, req QueryStandingOrderRequest) (model.StandingOrder, error) {
+	return s.repo.UpdateStandingOrder(ctx, req.StandingOrderID, func(order *model.StandingOrder) error {
+		if isFinished(order) {
+			return ErrStandingOrderFinished
+		}
+		order.Status = model.StandingOrderCanceled
+		return nil
+	})
+}
+
+func (s *service) QueryRuns(ctx context.Context, req QueryRunsRequest) ([]model.StandingOrderRun, error) {
+	if _, err := s.repo.GetStandingOrderByID(ctx, req.StandingOrderID); err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultRunsLimit
+	}
+	if limit > MaxRunsLimit {
+		limit = MaxRunsLimit
+	}
+	return s.repo.QueryRuns(ctx, req.StandingOrderID, limit)
+}
+
+// RunDueStandingOrders executes due standing orders one by one, so runs of the same source account don't compete for balance.
+func (s *service) RunDueStandingOrders(ctx context.Context, now time.Time) error {
+	now = now.UTC()
+	orders, err := s.repo.QueryDueStandingOrders(ctx, now, MaxDueStandingOrdersPerRun)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if err := s.run(ctx, order.StandingOrderID, now); err != nil {
+			log.GetSugger().Error("failed to run standing order", "standingOrderID", order.StandingOrderID, "err", err)
+		}
+	}
+	return nil
+}
+
+// run creates the transaction of the current run, records it, and moves the standing order to its next run.
+func (s *service) run(ctx context.Context, standingOrderID string, now time.Time) error {
+	claimed, err := s.repo.ClaimRun(ctx, standingOrderID, now, now.Add(RunLease))
+	if err != nil || !claimed {
+		return err
+	}
+	order, err := s.repo.GetStandingOrderByID(ctx, standingOrderID)
+	if err != nil {
+		return err
+	}
+
+	tCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(viper.GetInt(config.ConfigKeyCreateTransactionTimeout)))
+	defer cancel()
+	attempt := order.Attempts + 1
+	trx, err := s.transactionService.CreateTransaction(tCtx, transaction.CreateTransactionRequest{
+		SourceAccountID:      order.SourceAccountID,
+		DestinationAccountID: order.DestinationAccountID,
+		Amount:               formatAmount(order.Amount),
+		Currency:             order.Currency,
+		// the same run is never executed twice, even if the run is claimed again after lease
+		IdempotencyKey:  fmt.Sprintf("%s:%d:%d", order.StandingOrderID, order.ScheduledAt.Unix(), attempt),
+		ClientID:        IdempotencyClientID,
+		StandingOrderID: order.StandingOrderID,
+	})
+	run := model.StandingOrderRun{
+		StandingOrderID:   order.StandingOrderID,
+		TransactionID:     trx.TransactionID,
+		ScheduledAt:       order.ScheduledAt,
+		Attempt:           attempt,
+		TransactionStatus: trx.TransactionStatus,
+	}
+	// a timeout transaction is still processing, it's not a failed run
+	if err != nil && err != context.DeadlineExceeded {
+		run.Error = err.Error()
+		if trx.TransactionID == "" {
+			run.TransactionStatus = model.Failed
+		}
+	}
+	log.GetSugger().Info("standing order run", "standingOrderID", order.StandingOrderID, "transactionID", trx.TransactionID, "attempt", attempt, "err", err)
+
+	runErr := err
+	_, err = s.repo.SaveRun(ctx, run, func(o *model.StandingOrder) error {
+		if !isInsufficientFund(runErr) {
+			return advance(o, now)
+		}
+		switch o.FailurePolicy {
+		case model.FailurePolicyRetry:
+			if attempt <= maxRetries() {
+				o.Attempts = attempt
+				o.NextRunAt = now.Add(retryInterval())
+				return nil
+			}
+		case model.FailurePolicyPause:
+			if o.Status == model.StandingOrderActive {
+				o.Status = model.StandingOrderPaused
+			}
+		}
+		return advance(o, now)
+	})
+	return err
+}
+
+// advance moves the standing order to the first run after now, and completes it if the run is after its end time
+func advance(order *model.StandingOrder, now time.Time) error {
+	next, err := parseSchedule(order.Schedule)
+	if err != nil {
+		return err
+	}
+	order.ScheduledAt = next(order.ScheduledAt)
+	for !order.ScheduledAt.After(now) {
+		order.ScheduledAt = next(order.ScheduledAt)
+	}
+	order.NextRunAt = order.ScheduledAt
+	order.Attempts = 0
+	if order.EndAt != nil && order.ScheduledAt.After(*order.EndAt) && !isFinished(order) {
+		order.Status = model.StandingOrderCompleted
+	}
+	return nil
+}
+
+func isFinished(order *model.StandingOrder) bool {
+	return order.Status == model.StandingOrderCompleted || order.Status == model.StandingOrderCanceled
+}
+
+func isInsufficientFund(err error) bool {
+	return err == account.ErrInsufficientBalance || err == account.ErrCreditLimitExceeded
+}
+
+func parseFailurePolicy(policy string) (model.FailurePolicy, error) {
+	switch p := model.FailurePolicy(strings.ToLower(strings.TrimSpace(policy))); p {
+	case "":
+		return model.FailurePolicySkip, nil
+	case model.FailurePolicySkip, model.FailurePolicyRetry, model.FailurePolicyPause:
+		return p, nil
+	default:
+		return "", ErrInvalidFailurePolicy
+	}
+}
+
+// formatAmount formats positive inflated value without losing precision
+func formatAmount(amount int64) string {
+	return fmt.Sprintf("%d.%06d", amount/1e6, amount%1e6)
+}
+
+func maxRetries() int {
+	if retries := viper.GetInt(config.ConfigKeyStandingOrderMaxRetries); retries > 0 {
+		return retries
+	}
+	return DefaultMaxRetries
+}
+
+func retryInterval() time.Duration {
+	minutes := viper.GetInt(config.ConfigKeyStandingOrderRetryInterval)
+	if minutes <= 0 {
+		minutes = DefaultRetryIntervalMinutes
+	}
+	return time.Minute * time.Duration(minutes)
+}
@@ -0,0 +1,172 @@
+package standingorder
+
+import (
+	"context"
+	"main/common/config"
+	"main/common/db/testutils"
+	"main/internal/account"
+	"main/internal/transaction"
+	"main/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	config.InitForTest()
+}
+
+type standingOrderServiceSuite struct {
+	suite.Suite
+	accountDB     *gorm.DB
+	transactionDB *gorm.DB
+	service       Service
+}
+
+func (s *standingOrderServiceSuite) SetupTest() {
+	s.accountDB, _ = testutils.SetupTestDB()
+	s.transactionDB, _ = testutils.SetupTestDB()
+
+	_ = s.accountDB.AutoMigrate(model.Account{})
+	_ = s.accountDB.AutoMigrate(model.FundMovement{})
+	_ = s.accountDB.AutoMigrate(model.LedgerEntry{})
+	_ = s.accountDB.AutoMigrate(model.OutboxEvent{})
+	_ = s.transactionDB.AutoMigrate(model.Transaction{})
+	_ = s.transactionDB.AutoMigrate(model.TransactionEvent{})
+	_ = s.transactionDB.AutoMigrate(model.IdempotencyKey{})
+	_ = s.transactionDB.AutoMigrate(model.StandingOrder{})
+	_ = s.transactionDB.AutoMigrate(model.StandingOrderRun{})
+
+	testutils.PrepareData(s.accountDB, []model.Account{
+		{
+			AccountID: 1,
+			Balance:   10000000,
+		},
+		{
+			AccountID: 2,
+			Balance:   10000000,
+		},
+	})
+
+	accountRepo := account.NewRepository(s.accountDB)
+	transactionService, err := transaction.NewService(transaction.NewRepository(s.transactionDB), account.NewTCCService(s.accountDB), accountRepo)
+	s.Require().NoError(err)
+	s.service = NewService(NewRepository(s.transactionDB), accountRepo, transactionService)
+}
+
+func (s *standingOrderServiceSuite) TearDownTest() {
+	sqlDB, _ := s.accountDB.DB()
+	sqlDB.Close()
+
+	sqlDB, _ = s.transactionDB.DB()
+	sqlDB.Close()
+}
+
+func (s *standingOrderServiceSuite) createStandingOrder(amount, policy string) model.StandingOrder {
+	order, err := s.service.CreateStandingOrder(context.Background(), CreateStandingOrderRequest{
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               amount,
+		Schedule:             "@daily",
+		FailurePolicy:        policy,
+	})
+	assert.NoError(s.T(), err)
+	return order
+}
+
+func (s *standingOrderServiceSuite) Test_RunDueStandingOrders_Happyflow() {
+	ctx := context.Background()
+	order := s.createStandingOrder("1.5", "")
+	assert.Equal(s.T(), model.FailurePolicySkip, order.FailurePolicy)
+
+	now := time.Now()
+	assert.NoError(s.T(), s.service.RunDueStandingOrders(ctx, now))
+	// next run is not due yet
+	assert.NoError(s.T(), s.service.RunDueStandingOrders(ctx, now))
+
+	order, err := s.service.QueryStandingOrder(ctx, QueryStandingOrderRequest{StandingOrderID: order.StandingOrderID})
+	assert.NoError(s.T(), err)
+	assert.True(s.T(), order.NextRunAt.After(now))
+	assert.Equal(s.T(), order.ScheduledAt, order.NextRunAt)
+
+	runs, err := s.service.QueryRuns(ctx, QueryRunsRequest{StandingOrderID: order.StandingOrderID})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), runs, 1)
+	assert.Equal(s.T(), model.Fulfiled, runs[0].TransactionStatus)
+
+	var trx model.Transaction
+	assert.NoError(s.T(), s.transactionDB.Where("transaction_id = ?", runs[0].TransactionID).First(&trx).Error)
+	assert.Equal(s.T(), order.StandingOrderID, trx.StandingOrderID)
+	assert.Equal(s.T(), int64(1500000), trx.Amount)
+}
+
+func (s *standingOrderServiceSuite) Test_RunDueStandingOrders_InsufficientBalance() {
+	var (
+		ctx    = context.Background()
+		skip   = s.createStandingOrder("20", "skip")
+		retry  = s.createStandingOrder("20", "retry")
+		pause  = s.createStandingOrder("20", "pause")
+		now    = time.Now()
+		orders = map[string]model.StandingOrder{}
+	)
+	assert.NoError(s.T(), s.service.RunDueStandingOrders(ctx, now))
+	for _, id := range []string{skip.StandingOrderID, retry.StandingOrderID, pause.StandingOrderID} {
+		order, err := s.service.QueryStandingOrder(ctx, QueryStandingOrderRequest{StandingOrderID: id})
+		assert.NoError(s.T(), err)
+		orders[id] = order
+	}
+
+	assert.Equal(s.T(), model.StandingOrderActive, orders[skip.StandingOrderID].Status)
+	assert.Equal(s.T(), 0, orders[skip.StandingOrderID].Attempts)
+	assert.True(s.T(), orders[skip.StandingOrderID].ScheduledAt.After(now))
+
+	// retry keeps the same run, and executes it later
+	assert.Equal(s.T(), model.StandingOrderActive, orders[retry.StandingOrderID].Status)
+	assert.Equal(s.T(), 1, orders[retry.StandingOrderID].Attempts)
+	assert.Equal(s.T(), retry.ScheduledAt.Unix(), orders[retry.StandingOrderID].ScheduledAt.Unix())
+	assert.True(s.T(), orders[retry.StandingOrderID].NextRunAt.After(now))
+
+	assert.Equal(s.T(), model.StandingOrderPaused, orders[pause.StandingOrderID].Status)
+
+	runs, err := s.service.QueryRuns(ctx, QueryRunsRequest{StandingOrderID: retry.StandingOrderID})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), runs, 1)
+	assert.Equal(s.T(), model.Failed, runs[0].TransactionStatus)
+	assert.Equal(s.T(), account.ErrInsufficientBalance.Error(), runs[0].Error)
+
+	resumed, err := s.service.ResumeStandingOrder(ctx, QueryStandingOrderRequest{StandingOrderID: pause.StandingOrderID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.StandingOrderActive, resumed.Status)
+	_, err = s.service.ResumeStandingOrder(ctx, QueryStandingOrderRequest{StandingOrderID: pause.StandingOrderID})
+	assert.EqualError(s.T(), ErrStandingOrderNotPaused, err.Error())
+
+	_, err = s.service.CancelStandingOrder(ctx, QueryStandingOrderRequest{StandingOrderID: skip.StandingOrderID})
+	assert.NoError(s.T(), err)
+	_, err = s.service.PauseStandingOrder(ctx, QueryStandingOrderRequest{StandingOrderID: skip.StandingOrderID})
+	assert.EqualError(s.T(), ErrStandingOrderNotActive, err.Error())
+}
+
+func (s *standingOrderServiceSuite) Test_CreateStandingOrder_InvalidRequest() {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		req CreateStandingOrderRequest
+		err error
+	}{
+		{CreateStandingOrderRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "1", Schedule: "daily"}, ErrInvalidSchedule},
+		{CreateStandingOrderRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "1", Schedule: "@every 1s"}, ErrInvalidSchedule},
+		{CreateStandingOrderRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "1", Schedule: "@weekly", FailurePolicy: "ignore"}, ErrInvalidFailurePolicy},
+		{CreateStandingOrderRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "0", Schedule: "@weekly"}, transaction.ErrInvalidAmount},
+		{CreateStandingOrderRequest{SourceAccountID: 1, DestinationAccountID: 1, Amount: "1", Schedule: "@weekly"}, transaction.ErrSameAccountTransactions},
+		{CreateStandingOrderRequest{SourceAccountID: 1, DestinationAccountID: 3, Amount: "1", Schedule: "@every 2h"}, transaction.ErrInvalidReciever},
+	} {
+		_, err := s.service.CreateStandingOrder(ctx, tc.req)
+		assert.EqualError(s.T(), tc.err, err.Error())
+	}
+}
+
+func TestStandingOrderService(t *testing.T) {
+	suite.Run(t, &standingOrderServiceSuite{})
+}
@@ -0,0 +1,258 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"main/common/config"
+	"main/common/log"
+	"main/common/utils"
+	"main/model"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultApprovalExpirationMinutes is 1 day
+	DefaultApprovalExpirationMinutes = 24 * 60
+	// MaxExpiredApprovalsPerRun limits the approvals expired by one invalidator run, the rest are expired in next runs
+	MaxExpiredApprovalsPerRun = 200
+)
+
+var (
+	// ErrTransactionNotAwaitingApproval indicates the transaction does not need approval, or it's approved, rejected or canceled already
+	ErrTransactionNotAwaitingApproval = errors.New("transaction not awaiting approval")
+	// ErrApprovalExpired indicates the approval is expired and will be rejected by invalidator
+	ErrApprovalExpired  = errors.New("approval expired")
+	ErrApproverRequired = errors.New("approver required")
+	// ErrSelfApproval indicates the approver is the user created the transaction
+	ErrSelfApproval       = errors.New("self approval")
+	ErrApproverNotAllowed = errors.New("approver not allowed")
+	// ErrApproversNotConfigured indicates approval.approvers is empty, nobody can decide approvals until it's configured
+	ErrApproversNotConfigured = errors.New("approvers not configured")
+	// ErrRequesterRequired indicates the transfer needs approval but its maker is unknown, so a second user can not be told apart
+	ErrRequesterRequired = errors.New("requester required")
+)
+
+// requiresApproval returns whether the amount is above the approval threshold of the currency, there is no threshold if it's not configured
+func requiresApproval(currency string, amount int64) (bool, error) {
+	threshold := viper.GetString(config.ConfigKeyApprovalThresholds + "." + currency)
+	if threshold == "" {
+		return false, nil
+	}
+	inflatedValue, err := utils.ParseString(threshold)
+	if err != nil {
+		return false, err
+	}
+	return amount > inflatedValue, nil
+}
+
+func newApproval(transactionID, requestedBy string) *model.Approval {
+	minutes := viper.GetInt(config.ConfigKeyApprovalExpiration)
+	if minutes <= 0 {
+		minutes = DefaultApprovalExpirationMinutes
+	}
+	return &model.Approval{
+		TransactionID: transactionID,
+		Status:        model.ApprovalPending,
+		RequestedBy:   requestedBy,
+		ExpiredAt:     time.Now().Add(time.Minute * time.Duration(minutes)),
+	}
+}
+
+// checkApprover makes sure the approver is not the maker, and is one of the configured approvers.
+// A transaction without maker can not be approved, as the approver can not be proved to be a different user.
+// It fails closed, nobody can decide approvals if no approver is configured, as X-User-ID is not authenticated by this service.
+func checkApprover(approver, requestedBy string) error {
+	if approver == "" {
+		return ErrApproverRequired
+	}
+	if requestedBy == "" {
+		return ErrRequesterRequired
+	}
+	if approver == requestedBy {
+		return ErrSelfApproval
+	}
+	approvers := viper.GetStringSlice(config.ConfigKeyApprovers)
+	if len(approvers) == 0 {
+		return ErrApproversNotConfigured
+	}
+	for _, allowed := range approvers {
+		if allowed == approver {
+			return nil
+		}
+	}
+	return ErrApproverNotAllowed
+}
+
+// ApproveTransaction approves a transaction awaiting approval. It's processed as a normal transaction from Pending,
+// or moved to Scheduled if its execute_at is still in the future.
+func (s *service) ApproveTransaction(ctx context.Context, req ApprovalRequest) (model.Transaction, error) {
+	tx, approval, err := s.loadApproval(ctx, req)
+	if err != nil {
+		return tx, err
+	}
+	decide := func(ctx context.Context, to model.TransactionStatus) error {
+		return s.decideApproval(WithActor(ctx, ActorApprover), approval, req.Approver, req.Note, model.ApprovalApproved, to, ReasonApproved)
+	}
+
+	if tx.ExecuteAt != nil && tx.ExecuteAt.After(time.Now()) {
+		if err := decide(ctx, model.Scheduled); err != nil {
+			return tx, err
+		}
+		return s.queryWithApproval(ctx, tx.TransactionID)
+	}
+	tx.TransactionStatus = model.Pending
+	trx, err := s.startTransaction(ctx, tx, func(ctx context.Context, _ model.Transaction) error {
+		return decide(ctx, model.Pending)
+	})
+	if trx.TransactionID == "" {
+		return tx, err
+	}
+	trx.Approval, _ = s.getApproval(ctx, trx.TransactionID)
+	return trx, err
+}
+
+// ApproveBatch approves a batch awaiting approval, its legs are processed together like a new batch.
+func (s *service) ApproveBatch(ctx context.Context, req BatchApprovalRequest) (model.Batch, error) {
+	batch, approval, err := s.loadBatchApproval(ctx, req)
+	if err != nil {
+		return batch, err
+	}
+	legs := batch.Transactions
+	for i := range legs {
+		legs[i].TransactionStatus = model.Pending
+	}
+	batch, err = s.startBatch(ctx, batch, legs, func(ctx context.Context) error {
+		return s.decideApproval(WithActor(ctx, ActorApprover), approval, req.Approver, req.Note, model.ApprovalApproved, model.Pending, ReasonApproved)
+	})
+	if batch.BatchID == "" {
+		return batch, err
+	}
+	batch.Approval, _ = s.getApproval(ctx, batch.BatchID)
+	return batch, err
+}
+
+// RejectBatch rejects a batch awaiting approval, all of its legs are rejected and no fund is moved.
+func (s *service) RejectBatch(ctx context.Context, req BatchApprovalRequest) (model.Batch, error) {
+	batch, approval, err := s.loadBatchApproval(ctx, req)
+	if err != nil {
+		return batch, err
+	}
+	if err := s.decideApproval(WithActor(ctx, ActorApprover), approval, req.Approver, req.Note, model.ApprovalRejected, model.Rejected, ReasonRejected); err != nil {
+		return batch, err
+	}
+	if batch, err = s.QueryBatch(ctx, QueryBatchRequest{BatchID: req.BatchID}); err != nil {
+		return batch, err
+	}
+	batch.Approval, err = s.getApproval(ctx, batch.BatchID)
+	return batch, err
+}
+
+// RejectTransaction rejects a transaction awaiting approval, no fund is moved.
+func (s *service) RejectTransaction(ctx context.Context, req ApprovalRequest) (model.Transaction, error) {
+	tx, approval, err := s.loadApproval(ctx, req)
+	if err != nil {
+		return tx, err
+	}
+	if err := s.decideApproval(WithActor(ctx, ActorApprover), approval, req.Approver, req.Note, model.ApprovalRejected, model.Rejected, ReasonRejected); err != nil {
+		return tx, err
+	}
+	return s.queryWithApproval(ctx, tx.TransactionID)
+}
+
+// QueryApproval returns the approval of a transaction created above the approval threshold
+func (s *service) QueryApproval(ctx context.Context, req QueryTransactionRequest) (model.Approval, error) {
+	return s.repo.GetApproval(ctx, req.TransactionID)
+}
+
+// ExpireApprovals rejects transactions which are not approved or rejected before their approval expires.
+func (s *service) ExpireApprovals(ctx context.Context, now time.Time) error {
+	approvals, err := s.repo.QueryExpiredApprovals(ctx, now, MaxExpiredApprovalsPerRun)
+	if err != nil {
+		return err
+	}
+	for _, approval := range approvals {
+		err := s.decideApproval(ctx, approval, "", "", model.ApprovalExpired, model.Rejected, ReasonApprovalExpired)
+		if err != nil && err != ErrTransactionNotAwaitingApproval {
+			log.GetSugger().Error("failed to expire approval ", "transaction", approval.TransactionID, "err", err)
+		}
+	}
+	return nil
+}
+
+// loadApproval loads a transaction awaiting approval and its approval, and checks the approver can decide it
+func (s *service) loadApproval(ctx context.Context, req ApprovalRequest) (model.Transaction, model.Approval, error) {
+	tx, err := s.repo.GetTransactionByID(ctx, req.TransactionID)
+	if err != nil {
+		return model.Transaction{}, model.Approval{}, err
+	}
+	if tx.TransactionStatus != model.AwaitingApproval {
+		return tx, model.Approval{}, ErrTransactionNotAwaitingApproval
+	}
+	approval, err := s.repo.GetApproval(ctx, tx.TransactionID)
+	if err != nil {
+		return tx, model.Approval{}, err
+	}
+	return tx, approval, checkApproval(approval, req.Approver)
+}
+
+// loadBatchApproval loads a batch awaiting approval with its legs and its approval, and checks the approver can decide it
+func (s *service) loadBatchApproval(ctx context.Context, req BatchApprovalRequest) (model.Batch, model.Approval, error) {
+	batch, err := s.QueryBatch(ctx, QueryBatchRequest{BatchID: req.BatchID})
+	if err != nil {
+		return model.Batch{}, model.Approval{}, err
+	}
+	if batch.BatchStatus != model.AwaitingApproval {
+		return batch, model.Approval{}, ErrTransactionNotAwaitingApproval
+	}
+	approval, err := s.repo.GetApproval(ctx, batch.BatchID)
+	if err != nil {
+		return batch, model.Approval{}, err
+	}
+	return batch, approval, checkApproval(approval, req.Approver)
+}
+
+// checkApproval makes sure the approval is not expired and the approver can decide it
+func checkApproval(approval model.Approval, approver string) error {
+	if approval.ExpiredAt.Before(time.Now()) {
+		return ErrApprovalExpired
+	}
+	return checkApprover(approver, approval.RequestedBy)
+}
+
+// decideApproval saves the decision and moves the transaction, or the batch and all of its legs, to `to`.
+// ErrTransactionNotAwaitingApproval indicates it's decided by others.
+func (s *service) decideApproval(ctx context.Context, approval model.Approval, decidedBy, note string, status model.ApprovalStatus, to model.TransactionStatus, reason string) error {
+	now := time.Now()
+	approval.Status, approval.DecidedBy, approval.DecidedAt, approval.Note = status, decidedBy, &now, note
+	if note != "" {
+		reason += ": " + note
+	}
+	decide := s.repo.DecideApproval
+	if approval.BatchID != "" {
+		decide = s.repo.DecideBatchApproval
+	}
+	err := decide(ctx, approval, to, reason)
+	if _, ok := asTransitionError(err); ok || err == ErrBatchStatusChanged {
+		return ErrTransactionNotAwaitingApproval
+	}
+	return err
+}
+
+func (s *service) getApproval(ctx context.Context, id string) (*model.Approval, error) {
+	approval, err := s.repo.GetApproval(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+func (s *service) queryWithApproval(ctx context.Context, id string) (model.Transaction, error) {
+	tx, err := s.repo.GetTransactionByID(ctx, id)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	tx.Approval, err = s.getApproval(ctx, id)
+	return tx, err
+}
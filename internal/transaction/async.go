@@ -0,0 +1,143 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"main/common/config"
+	"main/common/log"
+	"main/common/recovery"
+	"main/model"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultAsyncWorkers   = 8
+	DefaultAsyncQueueSize = 100
+	DefaultWaitSeconds    = 10
+	MaxWaitSeconds        = 30
+	waitPollInterval      = 100 * time.Millisecond
+)
+
+// ErrTooManyPendingTransactions indicates the queue of asynchronous transactions is full
+var ErrTooManyPendingTransactions = errors.New("too many pending transactions")
+
+// workerPool processes asynchronous transactions with a bounded number of workers.
+// It's started on first use, so services never accepting asynchronous transactions don't start workers.
+// A slot of the queue is reserved before the transaction is saved, so a full queue rejects the request without saving anything.
+type workerPool struct {
+	once    sync.Once
+	slots   chan struct{}
+	jobs    chan model.Transaction
+	process func(trx model.Transaction)
+}
+
+func newWorkerPool(process func(trx model.Transaction)) *workerPool {
+	return &workerPool{process: process}
+}
+
+func (p *workerPool) start() {
+	workers := viper.GetInt(config.ConfigKeyAsyncWorkers)
+	if workers <= 0 {
+		workers = DefaultAsyncWorkers
+	}
+	queueSize := viper.GetInt(config.ConfigKeyAsyncQueueSize)
+	if queueSize <= 0 {
+		queueSize = DefaultAsyncQueueSize
+	}
+	p.slots = make(chan struct{}, queueSize)
+	p.jobs = make(chan model.Transaction, queueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for trx := range p.jobs {
+				p.release()
+				p.process(trx)
+			}
+		}()
+	}
+}
+
+// reserve takes a slot of the queue without blocking, false indicates the queue is full
+func (p *workerPool) reserve() bool {
+	p.once.Do(p.start)
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release gives back a slot taken by reserve
+func (p *workerPool) release() {
+	<-p.slots
+}
+
+// submit queues the transaction to a slot taken by reserve, it never blocks as there are at most queue size reserved slots
+func (p *workerPool) submit(trx model.Transaction) {
+	p.jobs <- trx
+}
+
+// enqueueTransaction saves the pending transaction with create, and queues it to be processed in background.
+// If the queue is full, the request is rejected before the transaction is saved, so nothing is bound to its idempotency key.
+func (s *service) enqueueTransaction(ctx context.Context, trx model.Transaction, create func(ctx context.Context, trx model.Transaction) error) (model.Transaction, error) {
+	if !s.asyncPool.reserve() {
+		log.GetSugger().Error("async queue is full, reject transaction", "transaction", trx.TransactionID)
+		return model.Transaction{}, ErrTooManyPendingTransactions
+	}
+	if err := create(ctx, trx); err != nil {
+		s.asyncPool.release()
+		return model.Transaction{}, err
+	}
+	s.asyncPool.submit(trx)
+	return trx, nil
+}
+
+// processAsync processes the transaction until it goes to final status or timeout, the worker is occupied until then.
+func (s *service) processAsync(trx model.Transaction) {
+	defer recovery.RecoverAndLog()
+	timeoutSeconds := viper.GetInt(config.ConfigKeyCreateTransactionTimeout)
+	// asynchronous transactions are accepted by api
+	ctx, cancel := context.WithTimeout(WithActor(context.Background(), ActorAPI), time.Second*time.Duration(timeoutSeconds))
+	defer cancel()
+
+	trxChan, err := s.processTransaction(ctx, &trx)
+	for tx := range trxChan {
+		trx = tx
+	}
+	log.GetSugger().Info("async transaction processed", "transaction", trx.TransactionID, "status", trx.TransactionStatus, "err", err)
+}
+
+// WaitTransaction long polls the transaction until it goes to a final status or timeout, and returns its latest status.
+func (s *service) WaitTransaction(ctx context.Context, req WaitTransactionRequest) (model.Transaction, error) {
+	timeoutSeconds := req.Timeout
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = DefaultWaitSeconds
+	}
+	if timeoutSeconds > MaxWaitSeconds {
+		timeoutSeconds = MaxWaitSeconds
+	}
+	tCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(timeoutSeconds))
+	defer cancel()
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		trx, err := s.repo.GetTransactionByID(ctx, req.TransactionID)
+		if err != nil || isFinal(trx.TransactionStatus) {
+			return trx, err
+		}
+		select {
+		case <-tCtx.Done():
+			return trx, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// isFinal returns if the transaction status will not be changed by processing the transaction
+func isFinal(status model.TransactionStatus) bool {
+	return status != model.Pending && status != model.Processing && status != model.Scheduled
+}
@@ -0,0 +1,273 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"main/common/config"
+	"main/common/log"
+	"main/common/recovery"
+	"main/common/utils"
+	"main/internal/account"
+	"main/model"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+const MaxBatchTransfers = 100
+
+var (
+	ErrEmptyBatch            = errors.New("empty batch")
+	ErrTooManyBatchTransfers = errors.New("too many batch transfers")
+	// ErrBatchStatusChanged indicates the batch is not in the expected status any more, it's moved by another process
+	ErrBatchStatusChanged = errors.New("batch status changed")
+)
+
+// CreateBatch saves the batch with a pending transaction for each transfer, and waits for it goes to final status until timeout.
+// Transfers of a batch are tried one by one, if all of them are tried, all of them will be confirmed, otherwise all of them will be canceled.
+// A batch above the approval threshold is saved with all transfers in AwaitingApproval, it's processed after a second user approves it.
+func (s *service) CreateBatch(ctx context.Context, req CreateBatchRequest) (model.Batch, error) {
+	if len(req.Transfers) == 0 {
+		return model.Batch{}, ErrEmptyBatch
+	}
+	if len(req.Transfers) > MaxBatchTransfers {
+		return model.Batch{}, ErrTooManyBatchTransfers
+	}
+
+	sourceAcc, err := s.accountRepo.GetAccountByID(ctx, req.SourceAccountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Batch{}, ErrInvalidSender
+		}
+		return model.Batch{}, err
+	}
+	if sourceAcc.IsClearing() {
+		return model.Batch{}, ErrClearingAccountNotAllowed
+	}
+	if req.Currency != "" && !strings.EqualFold(strings.TrimSpace(req.Currency), sourceAcc.Currency) {
+		return model.Batch{}, account.ErrCurrencyMismatch
+	}
+
+	batch := model.Batch{
+		BatchID:         utils.GenerateTransactionID(),
+		SourceAccountID: sourceAcc.AccountID,
+		Currency:        sourceAcc.Currency,
+		BatchStatus:     model.Pending,
+	}
+	legs := make([]model.Transaction, 0, len(req.Transfers))
+	for _, transfer := range req.Transfers {
+		if transfer.DestinationAccountID == req.SourceAccountID {
+			return model.Batch{}, ErrSameAccountTransactions
+		}
+		inflatedValue, err := ParseAmount(transfer.Amount)
+		if err != nil {
+			return model.Batch{}, err
+		}
+		destAcc, err := s.accountRepo.GetAccountByID(ctx, transfer.DestinationAccountID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return model.Batch{}, ErrInvalidReciever
+			}
+			return model.Batch{}, err
+		}
+		if destAcc.IsClearing() {
+			return model.Batch{}, ErrClearingAccountNotAllowed
+		}
+		if destAcc.Currency != sourceAcc.Currency {
+			return model.Batch{}, account.ErrCurrencyMismatch
+		}
+		if batch.TotalAmount, err = utils.SafeAdd(batch.TotalAmount, inflatedValue); err != nil {
+			return model.Batch{}, err
+		}
+		leg := model.Transaction{
+			SourceAccountID:      sourceAcc.AccountID,
+			DestinationAccountID: destAcc.AccountID,
+			Amount:               inflatedValue,
+			Currency:             sourceAcc.Currency,
+			TransactionID:        utils.GenerateTransactionID(),
+			TransactionStatus:    model.Pending,
+			TransactionType:      model.Transfer,
+			BatchID:              batch.BatchID,
+		}
+		if err := applyFee(&leg); err != nil {
+			return model.Batch{}, err
+		}
+		legs = append(legs, leg)
+	}
+
+	// legs of a batch are tried and confirmed together, so the batch is approved as a whole
+	needApproval, err := requiresApproval(batch.Currency, batch.TotalAmount)
+	if err != nil {
+		return model.Batch{}, err
+	}
+	// every leg is checked by risk rules, a denied leg fails the batch and a leg sent for review sends the whole batch
+	for _, leg := range legs {
+		risk, err := s.checkRisk(ctx, leg)
+		if err != nil {
+			return model.Batch{}, err
+		}
+		needApproval = needApproval || risk == RiskReview
+	}
+	if needApproval {
+		if req.RequestedBy == "" {
+			return model.Batch{}, ErrRequesterRequired
+		}
+		batch.BatchStatus = model.AwaitingApproval
+		for i := range legs {
+			legs[i].TransactionStatus = model.AwaitingApproval
+		}
+		batch.Approval = newApproval(batch.BatchID, req.RequestedBy)
+		batch.Approval.BatchID = batch.BatchID
+		if err := s.repo.CreateBatch(ctx, batch, legs); err != nil {
+			return model.Batch{}, err
+		}
+		batch.Transactions = legs
+		return batch, nil
+	}
+
+	return s.startBatch(ctx, batch, legs, func(ctx context.Context) error {
+		return s.repo.CreateBatch(ctx, batch, legs)
+	})
+}
+
+// startBatch saves the batch by save, then processes its legs and waits for the batch goes to final status until timeout
+func (s *service) startBatch(ctx context.Context, batch model.Batch, legs []model.Transaction, save func(ctx context.Context) error) (model.Batch, error) {
+	timeoutSeconds := viper.GetInt(config.ConfigKeyCreateTransactionTimeout)
+	tCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(timeoutSeconds))
+	defer cancel()
+	if err := save(tCtx); err != nil {
+		return model.Batch{}, err
+	}
+
+	batchChan, err := s.processBatch(tCtx, batch.BatchID, legs)
+
+	select {
+	case b, ok := <-batchChan:
+		if ok {
+			return b, err
+		}
+	case <-tCtx.Done():
+		return batch, err
+	}
+	return batch, err
+}
+
+func (s *service) QueryBatch(ctx context.Context, req QueryBatchRequest) (model.Batch, error) {
+	batch, err := s.repo.GetBatchByID(ctx, req.BatchID)
+	if err != nil {
+		return model.Batch{}, err
+	}
+	if batch.Transactions, err = s.repo.GetBatchTransactions(ctx, req.BatchID); err != nil {
+		return model.Batch{}, err
+	}
+	return batch, nil
+}
+
+// InvalidateBatch pushes an expired batch to final status. A pending batch may be partially tried, so all of its transfers are canceled.
+// A processing batch has all transfers tried, so all of them are confirmed.
+func (s *service) InvalidateBatch(ctx context.Context, req QueryBatchRequest) (model.Batch, error) {
+	batch, err := s.QueryBatch(ctx, req)
+	if err != nil {
+		return model.Batch{}, err
+	}
+	switch batch.BatchStatus {
+	case model.Pending:
+		s.cancelBatch(ctx, batch.BatchID, batch.Transactions)
+	case model.Processing:
+		s.confirmBatch(ctx, batch.BatchID, model.Processing, batch.Transactions)
+	default:
+		return batch, nil
+	}
+	return s.QueryBatch(ctx, req)
+}
+
+func (s *service) processBatch(ctx context.Context, batchID string, legs []model.Transaction) (<-chan model.Batch, error) {
+	err := s.tryBatch(ctx, legs)
+	batchChan := make(chan model.Batch)
+	go func() {
+		defer close(batchChan)
+		defer func() {
+			batch, err := s.QueryBatch(ctx, QueryBatchRequest{BatchID: batchID})
+			if err == nil {
+				batchChan <- batch
+			}
+		}()
+		defer recovery.RecoverAndLog()
+
+		if err != nil {
+			s.cancelBatch(ctx, batchID, legs)
+			return
+		}
+		s.confirmBatch(ctx, batchID, model.Pending, legs)
+	}()
+
+	return batchChan, err
+}
+
+// tryBatch tries transfers one by one and stops at the first failure
+func (s *service) tryBatch(ctx context.Context, legs []model.Transaction) error {
+	for i := range legs {
+		if err := s.tryWithTimeout(ctx, &legs[i]); err != nil {
+			log.GetSugger().Info("failed to try batch transfer", "batch", legs[i].BatchID, "transaction", legs[i].TransactionID, "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// cancelBatch cancels all transfers including the ones not tried yet, so a late try can not hold fund any more.
+// Batch goes to Failed only if all transfers are canceled, otherwise it will be canceled again by invalidator.
+func (s *service) cancelBatch(ctx context.Context, batchID string, legs []model.Transaction) {
+	canceled := true
+	for i := range legs {
+		// canceled by a previous invalidation
+		if legs[i].TransactionStatus == model.Failed {
+			continue
+		}
+		if err := s.retryCancel(ctx, &legs[i], ReasonBatchCanceled); err != nil {
+			canceled = false
+		}
+	}
+	if !canceled {
+		return
+	}
+	if err := s.repo.UpdateBatchStatus(ctx, batchID, model.Pending, model.Failed); err != nil {
+		log.GetSugger().Error("failed to update batch status", "batch", batchID, "err", err)
+	}
+}
+
+// confirmBatch moves a pending batch to Processing before confirming any transfer. If it fails, e.g. the batch is canceled by invalidator,
+// no transfer is confirmed. Batch goes to Fulfiled only if all transfers are confirmed, otherwise it will be confirmed again by invalidator.
+func (s *service) confirmBatch(ctx context.Context, batchID string, status model.TransactionStatus, legs []model.Transaction) {
+	if status == model.Pending {
+		if err := s.repo.UpdateBatchStatus(ctx, batchID, model.Pending, model.Processing); err != nil {
+			log.GetSugger().Error("failed to update batch status", "batch", batchID, "err", err)
+			return
+		}
+	}
+	confirmed := true
+	for i := range legs {
+		// legs are moved forward one by one, some of them may be moved by a previous invalidation
+		switch legs[i].TransactionStatus {
+		case model.Fulfiled:
+			continue
+		case model.Pending:
+			if err := s.repo.TransitTransactionStatus(ctx, legs[i].TransactionID, model.Pending, model.Processing, ReasonBatchAllTried); err != nil {
+				log.GetSugger().Error("failed to move batch transfer to processing", "batch", batchID, "transaction", legs[i].TransactionID, "err", err)
+				confirmed = false
+				continue
+			}
+		}
+		if err := s.retryConfirm(ctx, &legs[i]); err != nil {
+			confirmed = false
+		}
+	}
+	if !confirmed {
+		return
+	}
+	if err := s.repo.UpdateBatchStatus(ctx, batchID, model.Processing, model.Fulfiled); err != nil {
+		log.GetSugger().Error("failed to update batch status", "batch", batchID, "err", err)
+	}
+}
@@ -0,0 +1,117 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"main/common/config"
+	"main/common/log"
+	"main/model"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultAuthorizationExpirationMinutes is 7 days
+	DefaultAuthorizationExpirationMinutes = 7 * 24 * 60
+	// MaxExpiredAuthorizationsPerRun limits the authorizations voided by one invalidator run, the rest are voided in next runs
+	MaxExpiredAuthorizationsPerRun = 200
+)
+
+var (
+	// ErrTransactionNotAuthorized indicates the transaction is not authorized, or it's captured or voided already
+	ErrTransactionNotAuthorized = errors.New("transaction not authorized")
+	// ErrAuthorizationExpired indicates the authorization is expired and will be voided by invalidator
+	ErrAuthorizationExpired = errors.New("authorization expired")
+)
+
+func isManualCapture(req CreateTransactionRequest) bool {
+	return req.Capture != nil && !*req.Capture
+}
+
+func authorizationExpiredAt() time.Time {
+	minutes := viper.GetInt(config.ConfigKeyAuthorizationExpiration)
+	if minutes <= 0 {
+		minutes = DefaultAuthorizationExpirationMinutes
+	}
+	return time.Now().Add(time.Minute * time.Duration(minutes))
+}
+
+// ConfirmTransaction captures an authorized transaction, held fund is moved to destination by Confirm.
+// If Confirm fails, the transaction stays Processing and is confirmed by retry worker.
+func (s *service) ConfirmTransaction(ctx context.Context, req ConfirmTransactionRequest) (model.Transaction, error) {
+	tx, err := s.loadAuthorization(ctx, req.TransactionID)
+	if err != nil {
+		return tx, err
+	}
+	if tx.ExpiredAt.Before(time.Now()) {
+		return tx, ErrAuthorizationExpired
+	}
+	if err := s.repo.TransitTransactionStatus(ctx, tx.TransactionID, model.Authorized, model.Processing, ReasonCaptured); err != nil {
+		if _, ok := asTransitionError(err); ok {
+			return tx, ErrTransactionNotAuthorized
+		}
+		return tx, err
+	}
+	tx.TransactionStatus = model.Processing
+
+	tCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(viper.GetInt(config.ConfigKeyCreateTransactionTimeout)))
+	defer cancel()
+	_ = s.retryConfirm(tCtx, &tx)
+	return s.repo.GetTransactionByID(ctx, tx.TransactionID)
+}
+
+// VoidTransaction voids an authorized transaction, held fund is released by Cancel.
+// If Cancel fails, the transaction stays Voided and is canceled by retry worker.
+func (s *service) VoidTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error) {
+	tx, err := s.loadAuthorization(ctx, req.TransactionID)
+	if err != nil {
+		return tx, err
+	}
+	if err := s.voidTransaction(ctx, tx, ReasonVoided); err != nil {
+		if _, ok := asTransitionError(err); ok {
+			return tx, ErrTransactionNotAuthorized
+		}
+		return tx, err
+	}
+	return s.repo.GetTransactionByID(ctx, tx.TransactionID)
+}
+
+// ExpireAuthorizations voids authorized transactions which are not captured before they expire.
+func (s *service) ExpireAuthorizations(ctx context.Context, now time.Time) error {
+	transactions, err := s.repo.QueryExpiredAuthorizations(ctx, now, MaxExpiredAuthorizationsPerRun)
+	if err != nil {
+		return err
+	}
+	for _, tx := range transactions {
+		if err := s.voidTransaction(ctx, tx, ReasonAuthorizationExpired); err != nil {
+			log.GetSugger().Error("failed to void expired authorization ", "transaction", tx.TransactionID, "err", err)
+		}
+	}
+	return nil
+}
+
+func (s *service) loadAuthorization(ctx context.Context, id string) (model.Transaction, error) {
+	tx, err := s.repo.GetTransactionByID(ctx, id)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	if tx.TransactionStatus != model.Authorized {
+		return tx, ErrTransactionNotAuthorized
+	}
+	return tx, nil
+}
+
+// voidTransaction moves the transaction to Voided before Cancel, so it can not be captured any more.
+// Cancel is retried after the lease if this process dies before it's done.
+func (s *service) voidTransaction(ctx context.Context, tx model.Transaction, reason string) error {
+	if err := s.repo.VoidTransaction(ctx, tx.TransactionID, reason, time.Now().Add(retryLease)); err != nil {
+		return err
+	}
+	tx.TransactionStatus = model.Voided
+
+	tCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(viper.GetInt(config.ConfigKeyCreateTransactionTimeout)))
+	defer cancel()
+	_ = s.retryCancel(tCtx, &tx, reason)
+	return nil
+}
@@ -13,14 +13,90 @@ var createTransactionErrorMapping = map[error]*response.ExternalResponse{
 		Code:    400,
 		Message: "Insufficient Balance",
 	},
+	account.ErrCreditLimitExceeded: {
+		Code:    400,
+		Message: "Credit Limit Exceeded",
+	},
 	account.ErrExceedingMaxAmount: {
 		Code:    400,
-		Message: "Reciever Exceeding Maximum Balance Limit",
+		Message: "Exceeding Maximum Single Transfer Amount",
+	},
+	account.ErrExceedingDailyLimit: {
+		Code:    400,
+		Message: "Exceeding Daily Transfer Limit",
+	},
+	account.ErrExceedingMonthlyLimit: {
+		Code:    400,
+		Message: "Exceeding Monthly Transfer Limit",
 	},
 	ErrSameAccountTransactions: {
 		Code:    400,
 		Message: "Transfer to Same Account is Not Allowed",
 	},
+	ErrInvalidSender: {
+		Code:    400,
+		Message: "Sender ID Not Found",
+	},
+	ErrInvalidReciever: {
+		Code:    400,
+		Message: "Reciever ID Not Found",
+	},
+	account.ErrCurrencyMismatch: {
+		Code:    400,
+		Message: "Currency Mismatch Between Accounts",
+	},
+	account.ErrSourceAccountFrozen: {
+		Code:    403,
+		Message: "Sender Account Is Frozen",
+	},
+	account.ErrSourceAccountClosed: {
+		Code:    403,
+		Message: "Sender Account Is Closed",
+	},
+	account.ErrDestinationAccountClosed: {
+		Code:    403,
+		Message: "Reciever Account Is Closed",
+	},
+	ErrRiskDenied: {
+		Code:    403,
+		Message: "Transfer Is Denied By Risk Rules",
+	},
+	ErrRequesterRequired: {
+		Code:    400,
+		Message: "X-User-ID Header Is Required For Transfer Needing Approval",
+	},
+	ErrInvalidAmount: {
+		Code:    400,
+		Message: "Amount Must Be Greater Than Zero",
+	},
+	ErrClearingAccountNotAllowed: {
+		Code:    400,
+		Message: "Clearing Account Is Not Allowed",
+	},
+	ErrClearingAccountNotFound: {
+		Code:    400,
+		Message: "Funding Is Not Supported For This Currency",
+	},
+	ErrIdempotencyKeyReused: {
+		Code:    409,
+		Message: "Idempotency Key Is Used By A Different Request",
+	},
+	ErrInvalidExecuteAt: {
+		Code:    400,
+		Message: "Execute At Must Be In The Future",
+	},
+	ErrTooManyPendingTransactions: {
+		Code:    503,
+		Message: "Too Many Pending Transactions, Please Retry Later",
+	},
+	ErrInvalidIdempotencyKey: {
+		Code:    400,
+		Message: "Invalid Idempotency Key",
+	},
+	ErrClientIDRequired: {
+		Code:    400,
+		Message: "X-Client-ID Header Is Required With Idempotency-Key",
+	},
 	gorm.ErrRecordNotFound: {
 		Code:    400,
 		Message: "Sender/Reciever ID Not Found",
@@ -42,3 +118,231 @@ var createTransactionErrorMapping = map[error]*response.ExternalResponse{
 		Message: "Too Many Digits, We Only Support 6 Digits Most",
 	},
 }
+
+// createRefundErrorMapping overrides errors of original transaction on top of createTransactionErrorMapping
+var createRefundErrorMapping = func() map[error]*response.ExternalResponse {
+	mapping := map[error]*response.ExternalResponse{
+		gorm.ErrRecordNotFound: {
+			Code:    404,
+			Message: "Transaction Not Found",
+		},
+		ErrTransactionNotRefundable: {
+			Code:    409,
+			Message: "Transaction Is Not Refundable",
+		},
+		ErrRefundExceedsAmount: {
+			Code:    400,
+			Message: "Refund Amount Exceeds Refundable Amount",
+		},
+	}
+	for err, resp := range createTransactionErrorMapping {
+		if _, ok := mapping[err]; !ok {
+			mapping[err] = resp
+		}
+	}
+	return mapping
+}()
+
+// createBatchErrorMapping adds batch errors on top of createTransactionErrorMapping
+var createBatchErrorMapping = func() map[error]*response.ExternalResponse {
+	mapping := map[error]*response.ExternalResponse{
+		ErrEmptyBatch: {
+			Code:    400,
+			Message: "Batch Must Have At Least One Transfer",
+		},
+		ErrTooManyBatchTransfers: {
+			Code:    400,
+			Message: "Too Many Transfers In Batch",
+		},
+	}
+	for err, resp := range createTransactionErrorMapping {
+		if _, ok := mapping[err]; !ok {
+			mapping[err] = resp
+		}
+	}
+	return mapping
+}()
+
+// approvalErrorMapping adds approval errors on top of createTransactionErrorMapping, an approved transaction is processed right away
+var approvalErrorMapping = func() map[error]*response.ExternalResponse {
+	mapping := map[error]*response.ExternalResponse{
+		gorm.ErrRecordNotFound: {
+			Code:    404,
+			Message: "Transaction Not Found",
+		},
+		ErrTransactionNotAwaitingApproval: {
+			Code:    409,
+			Message: "Transaction Is Not Awaiting Approval",
+		},
+		ErrApprovalExpired: {
+			Code:    409,
+			Message: "Approval Is Expired",
+		},
+		ErrApproverRequired: {
+			Code:    400,
+			Message: "X-User-ID Header Is Required",
+		},
+		ErrSelfApproval: {
+			Code:    403,
+			Message: "Transaction Can Not Be Approved By Its Creator",
+		},
+		ErrApproverNotAllowed: {
+			Code:    403,
+			Message: "User Is Not Allowed To Approve Transactions",
+		},
+		ErrApproversNotConfigured: {
+			Code:    403,
+			Message: "No Approver Is Configured",
+		},
+		ErrRequesterRequired: {
+			Code:    403,
+			Message: "Transaction Without Creator Can Not Be Approved",
+		},
+	}
+	for err, resp := range createTransactionErrorMapping {
+		if _, ok := mapping[err]; !ok {
+			mapping[err] = resp
+		}
+	}
+	return mapping
+}()
+
+// batchApprovalErrorMapping adds batch errors on top of approvalErrorMapping, an approved batch is processed right away
+var batchApprovalErrorMapping = func() map[error]*response.ExternalResponse {
+	mapping := map[error]*response.ExternalResponse{
+		gorm.ErrRecordNotFound: {
+			Code:    404,
+			Message: "Batch Not Found",
+		},
+		ErrTransactionNotAwaitingApproval: {
+			Code:    409,
+			Message: "Batch Is Not Awaiting Approval",
+		},
+		ErrSelfApproval: {
+			Code:    403,
+			Message: "Batch Can Not Be Approved By Its Creator",
+		},
+		ErrRequesterRequired: {
+			Code:    403,
+			Message: "Batch Without Creator Can Not Be Approved",
+		},
+	}
+	for err, resp := range approvalErrorMapping {
+		if _, ok := mapping[err]; !ok {
+			mapping[err] = resp
+		}
+	}
+	return mapping
+}()
+
+var cancelTransactionErrorMapping = map[error]*response.ExternalResponse{
+	gorm.ErrRecordNotFound: {
+		Code:    404,
+		Message: "Transaction Not Found",
+	},
+	ErrTransactionNotCancelable: {
+		Code:    409,
+		Message: "Transaction Can Not Be Canceled",
+	},
+	ErrTransactionConfirmed: {
+		Code:    409,
+		Message: "Transaction Is Already Confirmed, Please Request A Refund",
+	},
+	ErrUserRequired: {
+		Code:    400,
+		Message: "X-User-ID Header Is Required",
+	},
+	ErrNotTransactionSender: {
+		Code:    403,
+		Message: "Transaction Can Only Be Canceled By Its Sender",
+	},
+	ErrTransactionWithoutCreator: {
+		Code:    409,
+		Message: "Transaction Was Created Without X-User-ID, It Can Not Be Canceled",
+	},
+	errInvalidParams: {
+		Code:    400,
+		Message: "Invalid Parameters",
+	},
+}
+
+var captureTransactionErrorMapping = map[error]*response.ExternalResponse{
+	gorm.ErrRecordNotFound: {
+		Code:    404,
+		Message: "Transaction Not Found",
+	},
+	ErrTransactionNotAuthorized: {
+		Code:    409,
+		Message: "Transaction Is Not Authorized",
+	},
+	ErrAuthorizationExpired: {
+		Code:    409,
+		Message: "Authorization Is Expired",
+	},
+	errInvalidParams: {
+		Code:    400,
+		Message: "Invalid Parameters",
+	},
+}
+
+var listTransactionsErrorMapping = map[error]*response.ExternalResponse{
+	errInvalidParams: {
+		Code:    400,
+		Message: "Invalid Parameters",
+	},
+	utils.ErrInvalidCursor: {
+		Code:    400,
+		Message: "Invalid Cursor",
+	},
+	ErrInvalidAmount: {
+		Code:    400,
+		Message: "Amount Must Be Greater Than Zero",
+	},
+	utils.ErrNegativeValue: {
+		Code:    400,
+		Message: "Amount Can Not Be Negative",
+	},
+	utils.ErrOverflow: {
+		Code:    400,
+		Message: "Amount Overflow",
+	},
+	utils.ErrTooManyDigits: {
+		Code:    400,
+		Message: "Too Many Digits, We Only Support 6 Digits Most",
+	},
+}
+
+var resolveTransactionErrorMapping = map[error]*response.ExternalResponse{
+	gorm.ErrRecordNotFound: {
+		Code:    404,
+		Message: "Transaction Not Found",
+	},
+	ErrTransactionNotInManualHandling: {
+		Code:    409,
+		Message: "Transaction Is Not In Manual Handling",
+	},
+	ErrInvalidResolveAction: {
+		Code:    400,
+		Message: "Action Must Be One Of confirm, cancel and close",
+	},
+	ErrResolveNoteRequired: {
+		Code:    400,
+		Message: "Note Is Required To Close Transaction",
+	},
+	ErrFundMovementNotTried: {
+		Code:    409,
+		Message: "Fund Movement Is Not Tried, It Can Not Be Confirmed",
+	},
+	account.ErrRollbacked: {
+		Code:    409,
+		Message: "Fund Movement Is Canceled, It Can Not Be Confirmed",
+	},
+	account.ErrConfirmed: {
+		Code:    409,
+		Message: "Fund Movement Is Confirmed, It Can Not Be Canceled",
+	},
+	errInvalidParams: {
+		Code:    400,
+		Message: "Invalid Parameters",
+	},
+}
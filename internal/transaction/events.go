@@ -0,0 +1,83 @@
+package transaction
+
+import (
+	"context"
+	"main/model"
+
+	"gorm.io/gorm"
+)
+
+// Actor is who changes the status of a transaction
+type Actor string
+
+const (
+	ActorAPI           Actor = "api"
+	ActorRetry         Actor = "retry"
+	ActorInvalidator   Actor = "invalidator"
+	ActorScheduler     Actor = "scheduler"
+	ActorStandingOrder Actor = "standing_order"
+	ActorOperator      Actor = "operator"
+	ActorApprover      Actor = "approver"
+	ActorOutboxRelay   Actor = "outbox_relay"
+)
+
+// Reasons of status changes
+const (
+	ReasonCreated              = "created"
+	ReasonTried                = "tried"
+	ReasonTryTimeout           = "try timeout, canceled"
+	ReasonConfirmed            = "confirmed"
+	ReasonExpired              = "expired"
+	ReasonDue                  = "scheduled time is due"
+	ReasonRevoked              = "canceled by sender"
+	ReasonRefunded             = "refund fulfiled"
+	ReasonBatchCanceled        = "batch canceled"
+	ReasonBatchAllTried        = "all transfers of batch tried"
+	ReasonBatchFulfilled       = "batch confirmed"
+	ReasonRetriesExhausted     = "retries exhausted"
+	ReasonCancelRetried        = "canceled on retry"
+	ReasonAuthorized           = "authorized"
+	ReasonCaptured             = "captured"
+	ReasonVoided               = "voided"
+	ReasonAuthorizationExpired = "authorization expired"
+	ReasonOperatorConfirmed    = "confirmed by operator"
+	ReasonOperatorCanceled     = "canceled by operator"
+	ReasonApproved             = "approved"
+	ReasonRejected             = "rejected by approver"
+	ReasonApprovalExpired      = "approval expired"
+	ReasonRelayConfirmed       = "fund movement confirmed"
+	ReasonRelayCanceled        = "fund movement canceled"
+)
+
+type actorKey struct{}
+
+// WithActor sets the actor of status changes made with the context
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFromContext returns the actor set by WithActor, default is ActorAPI
+func actorFromContext(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return ActorAPI
+}
+
+func createEvent(ctx context.Context, db *gorm.DB, transactionID string, from, to model.TransactionStatus, reason string) error {
+	return db.Create(&model.TransactionEvent{
+		TransactionID: transactionID,
+		FromStatus:    from,
+		ToStatus:      to,
+		Reason:        reason,
+		Actor:         string(actorFromContext(ctx)),
+	}).Error
+}
+
+// QueryTransactionEvents returns status changes of the transaction from the oldest to the latest
+func (s *service) QueryTransactionEvents(ctx context.Context, req QueryTransactionRequest) ([]model.TransactionEvent, error) {
+	if _, err := s.repo.GetTransactionByID(ctx, req.TransactionID); err != nil {
+		return nil, err
+	}
+	return s.repo.QueryTransactionEvents(ctx, req.TransactionID)
+}
@@ -0,0 +1,149 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"main/common/config"
+	"main/common/utils"
+	"main/model"
+	"math/big"
+
+	"github.com/spf13/viper"
+)
+
+type FeeType string
+
+const (
+	// FeeFlat charges a fixed fee
+	FeeFlat FeeType = "flat"
+	// FeePercentage charges a percentage of the amount
+	FeePercentage FeeType = "percentage"
+	// FeeTiered charges by the first tier covering the amount
+	FeeTiered FeeType = "tiered"
+)
+
+var (
+	// ErrInvalidFeeRule indicates the fee rule in config can not be applied
+	ErrInvalidFeeRule = errors.New("invalid fee rule")
+	// ErrFeeAccountNotFound indicates a fee is charged but there is no fee account configured for the currency
+	ErrFeeAccountNotFound = errors.New("fee account not found")
+)
+
+// FeeRule is the fee of a transfer, paid by source on top of the amount.
+// Amounts are decimal strings like request amounts, and Percentage is in percent, e.g. "0.5" charges 0.5% of the amount.
+// Empty Type means free.
+type FeeRule struct {
+	Type       FeeType   `mapstructure:"type"`
+	Flat       string    `mapstructure:"flat"`
+	Percentage string    `mapstructure:"percentage"`
+	Tiers      []FeeTier `mapstructure:"tiers"`
+}
+
+// FeeTier charges Flat plus Percentage of the amount for amounts up to UpTo inclusive.
+// Tiers are matched in order, and a tier without UpTo covers all amounts.
+type FeeTier struct {
+	UpTo       string `mapstructure:"up_to"`
+	Flat       string `mapstructure:"flat"`
+	Percentage string `mapstructure:"percentage"`
+}
+
+// Calculate returns the fee of the amount
+func (r FeeRule) Calculate(amount int64) (int64, error) {
+	switch r.Type {
+	case "":
+		return 0, nil
+	case FeeFlat:
+		return feeOf(amount, r.Flat, "")
+	case FeePercentage:
+		return feeOf(amount, "", r.Percentage)
+	case FeeTiered:
+		for _, tier := range r.Tiers {
+			if tier.UpTo != "" {
+				upTo, err := parseFeeValue(tier.UpTo)
+				if err != nil {
+					return 0, err
+				}
+				if amount > upTo {
+					continue
+				}
+			}
+			return feeOf(amount, tier.Flat, tier.Percentage)
+		}
+		return 0, nil
+	default:
+		return 0, ErrInvalidFeeRule
+	}
+}
+
+// feeOf returns flat plus percentage of amount, percentage is rounded half up to the smallest unit
+func feeOf(amount int64, flat, percentage string) (int64, error) {
+	fee, err := parseFeeValue(flat)
+	if err != nil {
+		return 0, err
+	}
+	rate, err := parseFeeValue(percentage)
+	if err != nil {
+		return 0, err
+	}
+	if rate > 0 {
+		// rate is inflated like amounts, so amount * rate / (100 * 1e6) is the percentage
+		denominator := big.NewInt(100 * 1e6)
+		product := new(big.Int).Mul(big.NewInt(amount), big.NewInt(rate))
+		product.Add(product, new(big.Int).Div(denominator, big.NewInt(2)))
+		quotient := product.Div(product, denominator)
+		if !quotient.IsInt64() {
+			return 0, utils.ErrOverflow
+		}
+		if fee, err = utils.SafeAdd(fee, quotient.Int64()); err != nil {
+			return 0, err
+		}
+	}
+	return fee, nil
+}
+
+// parseFeeValue parses a decimal string of fee rule into inflated value, empty string is 0
+func parseFeeValue(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	inflatedValue, err := utils.ParseString(value)
+	if err != nil || inflatedValue < 0 {
+		return 0, ErrInvalidFeeRule
+	}
+	return inflatedValue, nil
+}
+
+// feeRuleOf returns the fee rule of source account, or the default rule if the account has none
+func feeRuleOf(accountID int) (FeeRule, error) {
+	var rule FeeRule
+	key := fmt.Sprintf("%s.%d", config.ConfigKeyAccountFees, accountID)
+	if !viper.IsSet(key) {
+		key = config.ConfigKeyDefaultFee
+	}
+	if err := viper.UnmarshalKey(key, &rule); err != nil {
+		return FeeRule{}, ErrInvalidFeeRule
+	}
+	return rule, nil
+}
+
+// applyFee calculates the fee of a transfer and sets it on the transaction with the fee account of its currency.
+// Transfers from or to the fee account are free.
+func applyFee(trx *model.Transaction) error {
+	feeAccountID := viper.GetInt(config.ConfigKeyFeeAccounts + "." + trx.Currency)
+	if feeAccountID != 0 && (feeAccountID == trx.SourceAccountID || feeAccountID == trx.DestinationAccountID) {
+		return nil
+	}
+	rule, err := feeRuleOf(trx.SourceAccountID)
+	if err != nil {
+		return err
+	}
+	fee, err := rule.Calculate(trx.Amount)
+	if err != nil || fee == 0 {
+		return err
+	}
+	if feeAccountID == 0 {
+		return ErrFeeAccountNotFound
+	}
+	trx.Fee, trx.FeeAccountID = fee, feeAccountID
+	return nil
+}
@@ -3,8 +3,10 @@ package transaction
 import (
 	"context"
 	"errors"
+	"io"
 	"main/common/response"
 	"main/model"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -16,10 +18,30 @@ type Handler struct {
 
 var errInvalidParams = errors.New("invalid params")
 
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderClientID       = "X-Client-ID"
+	HeaderUserID         = "X-User-ID" // maker of a transfer, or the approver of it
+	HeaderPrefer         = "Prefer"
+	PreferRespondAsync   = "respond-async"
+)
+
 func NewHandler(service Service) *Handler {
 	return &Handler{service: service}
 }
 
+// mapCreateErrors maps errors of creating transfers, a deny of risk rules responds with the reason of the rule
+func mapCreateErrors(c *gin.Context, err error, errMap map[error]*response.ExternalResponse) {
+	var denied *RiskDeniedError
+	if deniedResp, ok := errMap[ErrRiskDenied]; ok && errors.As(err, &denied) {
+		resp := *deniedResp
+		resp.Message += ": " + denied.Reason
+		response.WithExternalResponse(c, resp)
+		return
+	}
+	response.MapExternalErrors(c, err, errMap)
+}
+
 func (h *Handler) CreateTransaction(c *gin.Context) {
 	var (
 		req         CreateTransactionRequest
@@ -29,16 +51,24 @@ func (h *Handler) CreateTransaction(c *gin.Context) {
 	)
 	defer func() {
 		if returnError != nil {
-			response.MapExternalErrors(c, *returnError, createTransactionErrorMapping)
+			mapCreateErrors(c, *returnError, createTransactionErrorMapping)
 			return
 		}
 		(&trx).FormatForDisplay()
+		if req.Async && !isFinal(trx.TransactionStatus) {
+			response.Accepted(c, "/api/v1/transactions/"+trx.TransactionID, trx)
+			return
+		}
 		response.Ok(c, trx)
 	}()
 	if err := c.ShouldBindJSON(&req); err != nil {
 		returnError = &errInvalidParams
 		return
 	}
+	req.IdempotencyKey = strings.TrimSpace(c.GetHeader(HeaderIdempotencyKey))
+	req.ClientID = strings.TrimSpace(c.GetHeader(HeaderClientID))
+	req.RequestedBy = strings.TrimSpace(c.GetHeader(HeaderUserID))
+	req.Async = strings.Contains(strings.ToLower(c.GetHeader(HeaderPrefer)), PreferRespondAsync)
 	trx, err = h.service.CreateTransaction(c, req)
 	// When Exceed deadline, return a processing transaction
 	if err != nil && err != context.DeadlineExceeded {
@@ -48,6 +78,305 @@ func (h *Handler) CreateTransaction(c *gin.Context) {
 
 }
 
+func (h *Handler) CreateDeposit(c *gin.Context) {
+	h.createFunding(c, h.service.CreateDeposit)
+}
+
+func (h *Handler) CreateWithdrawal(c *gin.Context) {
+	h.createFunding(c, h.service.CreateWithdrawal)
+}
+
+func (h *Handler) createFunding(c *gin.Context, create func(ctx context.Context, req FundingRequest) (model.Transaction, error)) {
+	var (
+		req         FundingRequest
+		returnError *error
+		err         error
+		trx         model.Transaction
+	)
+	defer func() {
+		if returnError != nil {
+			mapCreateErrors(c, *returnError, createTransactionErrorMapping)
+			return
+		}
+		(&trx).FormatForDisplay()
+		response.Ok(c, trx)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	req.RequestedBy = strings.TrimSpace(c.GetHeader(HeaderUserID))
+	trx, err = create(c, req)
+	// When Exceed deadline, return a processing transaction
+	if err != nil && err != context.DeadlineExceeded {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) CreateRefund(c *gin.Context) {
+	var (
+		req         RefundRequest
+		returnError *error
+		err         error
+		trx         model.Transaction
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, createRefundErrorMapping)
+			return
+		}
+		(&trx).FormatForDisplay()
+		response.Ok(c, trx)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	// body is optional, refund the remaining amount if it's empty
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			returnError = &errInvalidParams
+			return
+		}
+	}
+	trx, err = h.service.CreateRefund(c, req)
+	// When Exceed deadline, return a processing transaction
+	if err != nil && err != context.DeadlineExceeded {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) CreateBatch(c *gin.Context) {
+	var (
+		req         CreateBatchRequest
+		returnError *error
+		err         error
+		batch       model.Batch
+	)
+	defer func() {
+		if returnError != nil {
+			mapCreateErrors(c, *returnError, createBatchErrorMapping)
+			return
+		}
+		(&batch).FormatForDisplay()
+		response.Ok(c, batch)
+	}()
+	if err := c.ShouldBindJSON(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	req.RequestedBy = strings.TrimSpace(c.GetHeader(HeaderUserID))
+	batch, err = h.service.CreateBatch(c, req)
+	// When Exceed deadline, return a processing batch
+	if err != nil && err != context.DeadlineExceeded {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) QueryBatch(c *gin.Context) {
+	var req QueryBatchRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		response.ErrorParam(c, err.Error())
+		return
+	}
+	batch, err := h.service.QueryBatch(c, req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.ErrorNotFound(c)
+		} else {
+			response.ErrorServer(c)
+		}
+		return
+	}
+	(&batch).FormatForDisplay()
+	response.Ok(c, batch)
+}
+
+func (h *Handler) CancelTransaction(c *gin.Context) {
+	var (
+		req         CancelTransactionRequest
+		returnError *error
+		err         error
+		trx         model.Transaction
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, cancelTransactionErrorMapping)
+			return
+		}
+		(&trx).FormatForDisplay()
+		response.Ok(c, trx)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	req.UserID = c.GetHeader(HeaderUserID)
+	if trx, err = h.service.CancelTransaction(c, req); err != nil {
+		returnError = &err
+		return
+	}
+}
+
+// CaptureTransaction confirms an authorized transaction
+func (h *Handler) CaptureTransaction(c *gin.Context) {
+	var (
+		req         ConfirmTransactionRequest
+		returnError *error
+		err         error
+		trx         model.Transaction
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, captureTransactionErrorMapping)
+			return
+		}
+		(&trx).FormatForDisplay()
+		response.Ok(c, trx)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	if trx, err = h.service.ConfirmTransaction(c, req); err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) VoidTransaction(c *gin.Context) {
+	var (
+		req         QueryTransactionRequest
+		returnError *error
+		err         error
+		trx         model.Transaction
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, captureTransactionErrorMapping)
+			return
+		}
+		(&trx).FormatForDisplay()
+		response.Ok(c, trx)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	if trx, err = h.service.VoidTransaction(c, req); err != nil {
+		returnError = &err
+		return
+	}
+}
+
+// ApproveTransaction approves a transaction awaiting approval, it's processed right after approval
+func (h *Handler) ApproveTransaction(c *gin.Context) {
+	h.decideApproval(c, h.service.ApproveTransaction)
+}
+
+func (h *Handler) RejectTransaction(c *gin.Context) {
+	h.decideApproval(c, h.service.RejectTransaction)
+}
+
+func (h *Handler) decideApproval(c *gin.Context, decide func(ctx context.Context, req ApprovalRequest) (model.Transaction, error)) {
+	var (
+		req         ApprovalRequest
+		returnError *error
+		err         error
+		trx         model.Transaction
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, approvalErrorMapping)
+			return
+		}
+		(&trx).FormatForDisplay()
+		response.Ok(c, trx)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	// body with note is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		returnError = &errInvalidParams
+		return
+	}
+	req.Approver = strings.TrimSpace(c.GetHeader(HeaderUserID))
+	trx, err = decide(c, req)
+	// When Exceed deadline, return a processing transaction
+	if err != nil && err != context.DeadlineExceeded {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) ApproveBatch(c *gin.Context) {
+	h.decideBatchApproval(c, h.service.ApproveBatch)
+}
+
+func (h *Handler) RejectBatch(c *gin.Context) {
+	h.decideBatchApproval(c, h.service.RejectBatch)
+}
+
+func (h *Handler) decideBatchApproval(c *gin.Context, decide func(ctx context.Context, req BatchApprovalRequest) (model.Batch, error)) {
+	var (
+		req         BatchApprovalRequest
+		returnError *error
+		err         error
+		batch       model.Batch
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, batchApprovalErrorMapping)
+			return
+		}
+		(&batch).FormatForDisplay()
+		response.Ok(c, batch)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	// body with note is optional
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		returnError = &errInvalidParams
+		return
+	}
+	req.Approver = strings.TrimSpace(c.GetHeader(HeaderUserID))
+	batch, err = decide(c, req)
+	// When Exceed deadline, return a processing batch
+	if err != nil && err != context.DeadlineExceeded {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) QueryApproval(c *gin.Context) {
+	var req QueryTransactionRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		response.ErrorParam(c, err.Error())
+		return
+	}
+	approval, err := h.service.QueryApproval(c, req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.ErrorNotFound(c)
+		} else {
+			response.ErrorServer(c)
+		}
+		return
+	}
+	response.Ok(c, approval)
+}
+
 func (h *Handler) QueryTransaction(c *gin.Context) {
 	var req QueryTransactionRequest
 	if err := c.ShouldBindUri(&req); err != nil {
@@ -67,13 +396,125 @@ func (h *Handler) QueryTransaction(c *gin.Context) {
 	response.Ok(c, trx)
 }
 
+func (h *Handler) QueryTransactionEvents(c *gin.Context) {
+	var req QueryTransactionRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		response.ErrorParam(c, err.Error())
+		return
+	}
+	events, err := h.service.QueryTransactionEvents(c, req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.ErrorNotFound(c)
+		} else {
+			response.ErrorServer(c)
+		}
+		return
+	}
+	response.Ok(c, events)
+}
+
+func (h *Handler) WaitTransaction(c *gin.Context) {
+	var req WaitTransactionRequest
+	if err := c.ShouldBindUri(&req); err != nil {
+		response.ErrorParam(c, err.Error())
+		return
+	}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		response.ErrorParam(c, err.Error())
+		return
+	}
+	trx, err := h.service.WaitTransaction(c, req)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			response.ErrorNotFound(c)
+		} else {
+			response.ErrorServer(c)
+		}
+		return
+	}
+	(&trx).FormatForDisplay()
+	response.Ok(c, trx)
+}
+
+func (h *Handler) ListTransactions(c *gin.Context) {
+	h.listTransactions(c, h.service.ListTransactions)
+}
+
+// ListManualTransactions lists transactions in ManualHandling for operators
+func (h *Handler) ListManualTransactions(c *gin.Context) {
+	h.listTransactions(c, h.service.ListManualTransactions)
+}
+
+func (h *Handler) listTransactions(c *gin.Context, list func(ctx context.Context, req ListTransactionsRequest) ([]model.Transaction, string, error)) {
+	var (
+		req          ListTransactionsRequest
+		returnError  *error
+		transactions []model.Transaction
+		nextCursor   string
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, listTransactionsErrorMapping)
+			return
+		}
+		resp := ListTransactionsResponse{
+			Transactions: make([]model.Transaction, 0, len(transactions)),
+			NextCursor:   nextCursor,
+		}
+		for _, trx := range transactions {
+			(&trx).FormatForDisplay()
+			resp.Transactions = append(resp.Transactions, trx)
+		}
+		response.Ok(c, resp)
+	}()
+	if err := c.ShouldBindQuery(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	transactions, nextCursor, err := list(c, req)
+	if err != nil {
+		returnError = &err
+		return
+	}
+}
+
+func (h *Handler) ResolveTransaction(c *gin.Context) {
+	var (
+		req         ResolveTransactionRequest
+		returnError *error
+		err         error
+		trx         model.Transaction
+	)
+	defer func() {
+		if returnError != nil {
+			response.MapExternalErrors(c, *returnError, resolveTransactionErrorMapping)
+			return
+		}
+		(&trx).FormatForDisplay()
+		response.Ok(c, trx)
+	}()
+	if err := c.ShouldBindUri(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		returnError = &errInvalidParams
+		return
+	}
+	if trx, err = h.service.ResolveTransaction(c, req); err != nil {
+		returnError = &err
+		return
+	}
+}
+
 func (h *Handler) RetryTransaction(c *gin.Context) {
 	var req QueryTransactionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.ErrorParam(c, err.Error())
 		return
 	}
-	trx, err := h.service.RetryTransaction(c, req)
+	trx, err := h.service.RetryTransaction(WithActor(c, ActorRetry), req)
 	(&trx).FormatForDisplay()
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
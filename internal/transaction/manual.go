@@ -0,0 +1,111 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"main/internal/account"
+	"main/model"
+
+	"gorm.io/gorm"
+)
+
+// ResolveAction is how an operator resolves a transaction in ManualHandling
+type ResolveAction string
+
+const (
+	// ResolveConfirm re-drives confirm, the fund movement must be tried
+	ResolveConfirm ResolveAction = "confirm"
+	// ResolveCancel forces cancel, held fund is released
+	ResolveCancel ResolveAction = "cancel"
+	// ResolveClose closes the transaction with a note, fund is left as it is
+	ResolveClose ResolveAction = "close"
+)
+
+var (
+	// ErrTransactionNotInManualHandling indicates the transaction is not waiting for an operator
+	ErrTransactionNotInManualHandling = errors.New("transaction not in manual handling")
+	ErrInvalidResolveAction           = errors.New("invalid resolve action")
+	ErrResolveNoteRequired            = errors.New("resolve note required")
+	// ErrFundMovementNotTried indicates there is nothing to confirm
+	ErrFundMovementNotTried = errors.New("fund movement not tried")
+)
+
+// ListManualTransactions lists transactions waiting for an operator, filters other than status are supported.
+func (s *service) ListManualTransactions(ctx context.Context, req ListTransactionsRequest) ([]model.Transaction, string, error) {
+	req.Status = []int{int(model.ManualHandling)}
+	return s.ListTransactions(ctx, req)
+}
+
+// ResolveTransaction moves a transaction in ManualHandling to Fulfiled, Failed or Closed by the action.
+func (s *service) ResolveTransaction(ctx context.Context, req ResolveTransactionRequest) (model.Transaction, error) {
+	switch req.Action {
+	case ResolveConfirm, ResolveCancel:
+	case ResolveClose:
+		if req.Note == "" {
+			return model.Transaction{}, ErrResolveNoteRequired
+		}
+	default:
+		return model.Transaction{}, ErrInvalidResolveAction
+	}
+
+	tx, err := s.repo.GetTransactionByID(ctx, req.TransactionID)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	if tx.TransactionStatus != model.ManualHandling {
+		return tx, ErrTransactionNotInManualHandling
+	}
+
+	ctx = WithActor(ctx, ActorOperator)
+	switch req.Action {
+	case ResolveConfirm:
+		err = s.resolveConfirm(ctx, &tx, noteOr(req.Note, ReasonOperatorConfirmed))
+	case ResolveCancel:
+		err = s.resolveCancel(ctx, &tx, noteOr(req.Note, ReasonOperatorCanceled))
+	case ResolveClose:
+		err = s.repo.TransitTransactionStatus(ctx, tx.TransactionID, model.ManualHandling, model.Closed, req.Note)
+	}
+	if _, ok := asTransitionError(err); ok {
+		// resolved by another operator
+		return tx, ErrTransactionNotInManualHandling
+	}
+	if err != nil {
+		return tx, err
+	}
+	return s.repo.GetTransactionByID(ctx, req.TransactionID)
+}
+
+func (s *service) resolveConfirm(ctx context.Context, tx *model.Transaction, reason string) error {
+	if err := s.accountTCC.Confirm(ctx, tx.TransactionID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFundMovementNotTried
+		}
+		return err
+	}
+	if err := s.repo.TransitTransactionStatus(ctx, tx.TransactionID, model.ManualHandling, model.Fulfiled, reason); err != nil {
+		if isAppliedByRelay(err, model.Fulfiled) {
+			return nil
+		}
+		return err
+	}
+	s.settleRefund(ctx, tx)
+	return nil
+}
+
+func (s *service) resolveCancel(ctx context.Context, tx *model.Transaction, reason string) error {
+	if err := s.accountTCC.Cancel(ctx, tx.TransactionID); err != nil && err != account.ErrEmptyRollback {
+		return err
+	}
+	err := s.repo.TransitTransactionStatus(ctx, tx.TransactionID, model.ManualHandling, model.Failed, reason)
+	if isAppliedByRelay(err, model.Failed) {
+		return nil
+	}
+	return err
+}
+
+func noteOr(note, reason string) string {
+	if note == "" {
+		return reason
+	}
+	return note
+}
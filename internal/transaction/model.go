@@ -1,17 +1,157 @@
 package transaction
 
+import (
+	"main/model"
+	"time"
+)
+
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
 type CreateTransactionRequest struct {
 	SourceAccountID      int    `json:"source_account_id" binding:"required"`
 	DestinationAccountID int    `json:"destination_account_id" binding:"required"`
 	Amount               string `json:"amount" binding:"required"`
+	Currency             string `json:"currency"`
+	// ExecuteAt schedules the transfer in the future, transfer is processed immediately if it's empty
+	ExecuteAt *time.Time `json:"execute_at"`
+	// Capture false stops the transfer at Authorized after try, it's captured or voided by client later. Default is true.
+	Capture *bool `json:"capture"`
+	// Set from Idempotency-Key and X-Client-ID headers
+	IdempotencyKey string `json:"-"`
+	ClientID       string `json:"-"`
+	// RequestedBy is the maker of a transfer needs approval, set from X-User-ID header
+	RequestedBy string `json:"-"`
+	// Set by standing order runs
+	StandingOrderID string `json:"-"`
+	// Async saves the transaction and processes it in background, set from Prefer: respond-async header
+	Async bool `json:"-"`
+}
+
+// FundingRequest is the request of deposit and withdrawal
+type FundingRequest struct {
+	AccountID uint64 `uri:"account_id" json:"-" binding:"required"`
+	Amount    string `json:"amount" binding:"required"`
+	// RequestedBy is the maker of a funding sent for review by risk rules, set from X-User-ID header
+	RequestedBy string `json:"-"`
+}
+
+// RefundRequest refunds a fulfiled transaction. Amount is optional, the remaining refundable amount is refunded if it's empty.
+type RefundRequest struct {
+	TransactionID string `uri:"transaction_id" json:"-" binding:"required"`
+	Amount        string `json:"amount"`
+}
+
+// CreateBatchRequest transfers from one source account to many destinations atomically
+type CreateBatchRequest struct {
+	SourceAccountID int                    `json:"source_account_id" binding:"required"`
+	Currency        string                 `json:"currency"`
+	Transfers       []BatchTransferRequest `json:"transfers" binding:"required,dive"`
+	// RequestedBy is the maker of a batch needs approval, set from X-User-ID header
+	RequestedBy string `json:"-"`
+}
+
+type BatchTransferRequest struct {
+	DestinationAccountID int    `json:"destination_account_id" binding:"required"`
+	Amount               string `json:"amount" binding:"required"`
 }
 
+type QueryBatchRequest struct {
+	BatchID string `uri:"batch_id" json:"batch_id" binding:"required"`
+}
+
+// ConfirmTransactionRequest captures an authorized transaction
 type ConfirmTransactionRequest struct {
-	TransactionID string `json:"transaction_id" binding:"required"`
+	TransactionID string `uri:"transaction_id" json:"transaction_id" binding:"required"`
+}
+
+// ApprovalRequest approves or rejects a transaction awaiting approval, Approver is set from X-User-ID header
+type ApprovalRequest struct {
+	TransactionID string `uri:"transaction_id" json:"-" binding:"required"`
+	Note          string `json:"note"`
+	Approver      string `json:"-"`
+}
+
+// BatchApprovalRequest approves or rejects a batch awaiting approval, Approver is set from X-User-ID header
+type BatchApprovalRequest struct {
+	BatchID  string `uri:"batch_id" json:"-" binding:"required"`
+	Note     string `json:"note"`
+	Approver string `json:"-"`
+}
+
+// WaitTransactionRequest long polls a transaction until it goes to a final status or Timeout seconds
+type WaitTransactionRequest struct {
+	TransactionID string `uri:"transaction_id" binding:"required"`
+	Timeout       int    `form:"timeout"`
 }
 
 type (
 	QueryTransactionRequest struct {
 		TransactionID string `uri:"transaction_id" json:"transaction_id" binding:"required"`
 	}
+
+	// CancelTransactionRequest cancels a transaction by its sender, UserID is from X-User-ID header
+	CancelTransactionRequest struct {
+		TransactionID string `uri:"transaction_id" binding:"required"`
+		UserID        string `json:"-"`
+	}
 )
+
+// ResolveTransactionRequest resolves a transaction in ManualHandling, Action is one of confirm, cancel and close.
+// Note is recorded as the reason of the status change, it's required to close a transaction.
+type ResolveTransactionRequest struct {
+	TransactionID string        `uri:"transaction_id" json:"-" binding:"required"`
+	Action        ResolveAction `json:"action" binding:"required"`
+	Note          string        `json:"note"`
+}
+
+// ListTransactionsRequest filters transactions, all filters are optional
+type ListTransactionsRequest struct {
+	AccountID            int       `form:"account_id"` // either source or destination
+	SourceAccountID      int       `form:"source_account_id"`
+	DestinationAccountID int       `form:"destination_account_id"`
+	Status               []int     `form:"status"`
+	MinAmount            string    `form:"min_amount"`                                   // inclusive
+	MaxAmount            string    `form:"max_amount"`                                   // inclusive
+	From                 time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"` // created_at, inclusive
+	To                   time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`   // created_at, exclusive
+	Cursor               string    `form:"cursor"`
+	Limit                int       `form:"limit"`
+}
+
+// TransactionQuery is the query of transactions, ordered from the latest created to the oldest.
+// Zero value of a field means no filter on it.
+type TransactionQuery struct {
+	AccountID            int
+	SourceAccountID      int
+	DestinationAccountID int
+	Statuses             []model.TransactionStatus
+	MinAmount            int64
+	MaxAmount            int64
+	From                 time.Time
+	To                   time.Time
+	BeforeTime           time.Time // cursor position, zero value means start from the latest
+	BeforeID             uint
+	Limit                int
+}
+
+// TransferStatsQuery is the query of transfers sent by a source account since a time, used by risk rules.
+// Zero DestinationAccountID means transfers to any account.
+type TransferStatsQuery struct {
+	SourceAccountID      int
+	DestinationAccountID int
+	Since                time.Time
+}
+
+// TransferStats is the number and total amount of transfers matching a TransferStatsQuery
+type TransferStats struct {
+	Count int64
+	Total int64
+}
+
+type ListTransactionsResponse struct {
+	Transactions []model.Transaction `json:"transactions"`
+	NextCursor   string              `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,74 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"main/common/log"
+	"main/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultOutboxRelayIntervalSeconds = 5
+	// MaxOutboxEventsPerRun limits the outbox events relayed by one run, the rest are relayed in next runs
+	MaxOutboxEventsPerRun = 200
+)
+
+// RelayOutbox applies the fund movement stage changes in account outbox to transaction_tab.
+// A confirmed fund movement moves its transaction to Fulfiled, and a canceled one moves its pending transaction to Failed.
+// Applying an event is idempotent, so an event applied but not marked as relayed is applied again safely.
+func (s *service) RelayOutbox(ctx context.Context) error {
+	events, err := s.accountRepo.QueryOutboxEvents(ctx, MaxOutboxEventsPerRun)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := s.relayOutboxEvent(ctx, event); err != nil {
+			// keep the event, it's relayed again in next run
+			log.GetSugger().Error("failed to relay outbox event ", "event", event.ID, "transaction", event.TransactionID, "err", err)
+			continue
+		}
+		if err := s.accountRepo.MarkOutboxEventRelayed(ctx, event.ID, time.Now()); err != nil {
+			log.GetSugger().Error("failed to mark outbox event relayed ", "event", event.ID, "transaction", event.TransactionID, "err", err)
+		}
+	}
+	return nil
+}
+
+// relayOutboxEvent moves the transaction to the status matching the stage of its fund movement.
+// The transaction is left as it is if it's in the status already, or the stage doesn't decide its status:
+//   - Tried. The next status depends on the transaction, e.g. Processing, Authorized or waiting for its batch
+//   - Confirmed of a transaction not confirming yet, it can not happen as Confirm is only called on Processing
+//   - ManualHandling. It's owned by the operator, who resolves it after checking the fund movement
+//   - Canceled of a processing transaction, it can not happen as a processing transaction is only confirmed
+func (s *service) relayOutboxEvent(ctx context.Context, event model.OutboxEvent) error {
+	tx, err := s.repo.GetTransactionByID(ctx, event.TransactionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.GetSugger().Info("skip outbox event without transaction ", "event", event.ID, "transaction", event.TransactionID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case event.Stage == model.Confirmed && tx.TransactionStatus == model.Processing:
+		if err := s.repo.TransitTransactionStatus(ctx, tx.TransactionID, tx.TransactionStatus, model.Fulfiled, ReasonRelayConfirmed); err != nil {
+			return err
+		}
+		s.settleRefund(ctx, &tx)
+	case event.Stage == model.Canceled && tx.TransactionStatus == model.Pending:
+		return s.repo.TransitTransactionStatus(ctx, tx.TransactionID, tx.TransactionStatus, model.Failed, ReasonRelayCanceled)
+	case event.Stage == model.Canceled && isCancelDecided(tx.TransactionStatus):
+		// status is moved before cancel, only the retry is left
+		return s.repo.ClearRetry(ctx, tx.TransactionID, tx.TransactionStatus)
+	}
+	return nil
+}
+
+// isAppliedByRelay returns whether err rejects moving the transaction to status because outbox relay has moved it there
+func isAppliedByRelay(err error, status model.TransactionStatus) bool {
+	transitionErr, ok := asTransitionError(err)
+	return ok && transitionErr.Current == status
+}
@@ -11,12 +11,42 @@ import (
 
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Repository interface {
 	CreateTransaction(ctx context.Context, transaction Transaction) error
+	CreateTransactionWithIdempotencyKey(ctx context.Context, transaction Transaction, key IdempotencyKey) error
+	GetIdempotencyKey(ctx context.Context, clientID, key string) (IdempotencyKey, error)
 	GetTransactionByID(ctx context.Context, id string) (Transaction, error)
-	UpdateTransactionStatus(ctx context.Context, id string, status model.TransactionStatus) error
+	QueryTransactions(ctx context.Context, query TransactionQuery) ([]Transaction, error)
+	CreateRefund(ctx context.Context, refund Transaction) error
+	SumRefundAmount(ctx context.Context, originalTransactionID string) (int64, error)
+	SettleRefund(ctx context.Context, originalTransactionID string) error
+	TransitTransactionStatus(ctx context.Context, id string, from, to model.TransactionStatus, reason string) error
+	MarkManualHandling(ctx context.Context, id string, from model.TransactionStatus, lastError string) error
+	AuthorizeTransaction(ctx context.Context, id string, expiredAt time.Time) error
+	VoidTransaction(ctx context.Context, id string, reason string, retryAt time.Time) error
+	ClearRetry(ctx context.Context, id string, status model.TransactionStatus) error
+	QueryExpiredAuthorizations(ctx context.Context, now time.Time, limit int) ([]Transaction, error)
+	ScheduleRetry(ctx context.Context, id string, from model.TransactionStatus, nextRetryAt time.Time, lastError string) error
+	QueryDueRetryTransactions(ctx context.Context, now time.Time, limit int) ([]Transaction, error)
+	ClaimRetry(ctx context.Context, id string, now, leaseUntil time.Time) (bool, error)
+	QueryTransactionEvents(ctx context.Context, id string) ([]TransactionEvent, error)
+	CreateBatch(ctx context.Context, batch Batch, transactions []Transaction) error
+	GetBatchByID(ctx context.Context, id string) (Batch, error)
+	GetBatchTransactions(ctx context.Context, batchID string) ([]Transaction, error)
+	UpdateBatchStatus(ctx context.Context, id string, from, to model.TransactionStatus) error
+	QueryExpiredBatches(ctx context.Context) ([]Batch, error)
+	QueryDueScheduledTransactions(ctx context.Context, now time.Time, limit int) ([]Transaction, error)
+	ClaimScheduledTransaction(ctx context.Context, id string, now time.Time) (bool, error)
+	RevokeScheduledTransaction(ctx context.Context, id string) (bool, error)
+	RevokePendingTransaction(ctx context.Context, id string, retryAt time.Time) error
+	GetApproval(ctx context.Context, id string) (Approval, error)
+	DecideApproval(ctx context.Context, decision Approval, to model.TransactionStatus, reason string) error
+	DecideBatchApproval(ctx context.Context, decision Approval, to model.TransactionStatus, reason string) error
+	QueryExpiredApprovals(ctx context.Context, now time.Time, limit int) ([]Approval, error)
+	QueryTransferStats(ctx context.Context, query TransferStatsQuery) (TransferStats, error)
 	Transaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error
 	QueryExpiredTransactions(ctx context.Context) ([]model.Transaction, error)
 }
@@ -32,10 +62,50 @@ func NewRepository(db *gorm.DB) Repository {
 func (r *repository) CreateTransaction(ctx context.Context, transaction Transaction) error {
 	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*2)
 	defer cancel()
+	return r.db.WithContext(ctxTimeout).Transaction(func(tx *gorm.DB) error {
+		return createTransaction(ctx, tx, transaction)
+	})
+}
+
+// CreateTransactionWithIdempotencyKey saves the idempotency key and the transaction in one db transaction.
+// ErrDuplicatedIdempotencyKey indicates the key is already used by the client.
+func (r *repository) CreateTransactionWithIdempotencyKey(ctx context.Context, transaction Transaction, key IdempotencyKey) error {
+	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*2)
+	defer cancel()
+	return r.db.WithContext(ctxTimeout).Transaction(func(tx *gorm.DB) error {
+		key.TransactionID = transaction.TransactionID
+		if err := tx.Create(&key).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrDuplicatedIdempotencyKey
+			}
+			return err
+		}
+		return createTransaction(ctx, tx, transaction)
+	})
+}
+
+func (r *repository) GetIdempotencyKey(ctx context.Context, clientID, key string) (IdempotencyKey, error) {
+	var idempotencyKey IdempotencyKey
+	if err := r.db.WithContext(ctx).Where("client_id = ? AND idempotency_key = ?", clientID, key).First(&idempotencyKey).Error; err != nil {
+		return IdempotencyKey{}, err
+	}
+	return idempotencyKey, nil
+}
+
+// createTransaction saves the transaction, its approval if there is one, and its created event, db should be a db transaction
+func createTransaction(ctx context.Context, db *gorm.DB, transaction Transaction) error {
 	now := time.Now()
 	// Set expiration time
 	transaction.ExpiredAt = now.Add(time.Minute * time.Duration(viper.GetInt(config.ConfigKeyTransactionExpiration)))
-	return r.db.WithContext(ctxTimeout).Create(&transaction).Error
+	if err := db.Create(&transaction).Error; err != nil {
+		return err
+	}
+	if transaction.Approval != nil {
+		if err := db.Create(transaction.Approval).Error; err != nil {
+			return err
+		}
+	}
+	return createEvent(ctx, db, transaction.TransactionID, 0, transaction.TransactionStatus, ReasonCreated)
 }
 
 func (r *repository) GetTransactionByID(ctx context.Context, id string) (Transaction, error) {
@@ -46,8 +116,451 @@ func (r *repository) GetTransactionByID(ctx context.Context, id string) (Transac
 	return transaction, nil
 }
 
-func (r *repository) UpdateTransactionStatus(ctx context.Context, id string, status model.TransactionStatus) error {
-	return r.db.Model(&Transaction{}).Where("transaction_id = ?", id).Update("transaction_status", status).Error
+func (r *repository) QueryTransactions(ctx context.Context, query TransactionQuery) ([]Transaction, error) {
+	db := r.db.WithContext(ctx).Model(&Transaction{})
+	if query.AccountID != 0 {
+		db = db.Where("source_account_id = ? OR destination_account_id = ?", query.AccountID, query.AccountID)
+	}
+	if query.SourceAccountID != 0 {
+		db = db.Where("source_account_id = ?", query.SourceAccountID)
+	}
+	if query.DestinationAccountID != 0 {
+		db = db.Where("destination_account_id = ?", query.DestinationAccountID)
+	}
+	if len(query.Statuses) > 0 {
+		db = db.Where("transaction_status IN ?", query.Statuses)
+	}
+	if query.MinAmount != 0 {
+		db = db.Where("amount >= ?", query.MinAmount)
+	}
+	if query.MaxAmount != 0 {
+		db = db.Where("amount <= ?", query.MaxAmount)
+	}
+	if !query.From.IsZero() {
+		db = db.Where("created_at >= ?", query.From)
+	}
+	if !query.To.IsZero() {
+		db = db.Where("created_at < ?", query.To)
+	}
+	if !query.BeforeTime.IsZero() {
+		db = db.Where("created_at < ? OR (created_at = ? AND id < ?)", query.BeforeTime, query.BeforeTime, query.BeforeID)
+	}
+	var transactions []Transaction
+	if err := db.Order("created_at DESC, id DESC").Limit(query.Limit).Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// refundingStatuses are statuses of refunds taking the refundable amount of original transaction
+var refundingStatuses = []TransactionStatus{Pending, Processing, Fulfiled}
+
+// CreateRefund locks the original transaction and saves the refund if the amount of refunds doesn't exceed the original amount.
+func (r *repository) CreateRefund(ctx context.Context, refund Transaction) error {
+	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*2)
+	defer cancel()
+	return r.db.WithContext(ctxTimeout).Transaction(func(tx *gorm.DB) error {
+		var original Transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("transaction_id = ?", refund.OriginalTransactionID).First(&original).Error; err != nil {
+			return err
+		}
+		refunded, err := sumRefundAmount(tx, original.TransactionID, refundingStatuses)
+		if err != nil {
+			return err
+		}
+		if refunded+refund.Amount > original.Amount {
+			return ErrRefundExceedsAmount
+		}
+		return createTransaction(ctx, tx, refund)
+	})
+}
+
+// SumRefundAmount sums the amount of refunds in progress or fulfiled of the original transaction
+func (r *repository) SumRefundAmount(ctx context.Context, originalTransactionID string) (int64, error) {
+	return sumRefundAmount(r.db.WithContext(ctx), originalTransactionID, refundingStatuses)
+}
+
+// SettleRefund updates the original transaction to Refunded if the fulfiled refunds cover its amount, or PartiallyRefunded otherwise.
+func (r *repository) SettleRefund(ctx context.Context, originalTransactionID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var original Transaction
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("transaction_id = ?", originalTransactionID).First(&original).Error; err != nil {
+			return err
+		}
+		refunded, err := sumRefundAmount(tx, originalTransactionID, []TransactionStatus{Fulfiled})
+		if err != nil {
+			return err
+		}
+		status := PartiallyRefunded
+		if refunded >= original.Amount {
+			status = Refunded
+		}
+		if status == original.TransactionStatus {
+			return nil
+		}
+		return transitStatus(ctx, tx, originalTransactionID, original.TransactionStatus, status, ReasonRefunded)
+	})
+}
+
+func sumRefundAmount(db *gorm.DB, originalTransactionID string, statuses []TransactionStatus) (int64, error) {
+	var refunded int64
+	err := db.Model(&Transaction{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("original_transaction_id = ? AND transaction_type = ? AND transaction_status IN ?", originalTransactionID, Refund, statuses).
+		Scan(&refunded).Error
+	return refunded, err
+}
+
+// TransitTransactionStatus moves the transaction from status `from` to `to` and records the change with reason.
+// It returns a TransitionError if the change is illegal or the transaction is not in `from` status any more.
+func (r *repository) TransitTransactionStatus(ctx context.Context, id string, from, to model.TransactionStatus, reason string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return transitStatus(ctx, tx, id, from, to, reason)
+	})
+}
+
+// MarkManualHandling moves the transaction from status `from` to ManualHandling and saves the last error
+func (r *repository) MarkManualHandling(ctx context.Context, id string, from model.TransactionStatus, lastError string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return transitStatusWith(ctx, tx, id, from, ManualHandling, ReasonRetriesExhausted, map[string]interface{}{
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": lastError,
+		})
+	})
+}
+
+// AuthorizeTransaction moves a tried pending transaction to Authorized, it holds fund until expiredAt
+func (r *repository) AuthorizeTransaction(ctx context.Context, id string, expiredAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return transitStatusWith(ctx, tx, id, Pending, Authorized, ReasonAuthorized, map[string]interface{}{
+			"expired_at": expiredAt,
+		})
+	})
+}
+
+// VoidTransaction moves an authorized transaction to Voided before its fund movement is canceled.
+// Cancel is retried at retryAt unless it's cleared by ClearRetry.
+func (r *repository) VoidTransaction(ctx context.Context, id string, reason string, retryAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return transitStatusWith(ctx, tx, id, Authorized, Voided, reason, map[string]interface{}{
+			"next_retry_at": retryAt,
+		})
+	})
+}
+
+// ClearRetry clears the next retry of the transaction in status `status`
+func (r *repository) ClearRetry(ctx context.Context, id string, status model.TransactionStatus) error {
+	return r.db.Model(&Transaction{}).
+		Where("transaction_id = ? AND transaction_status = ?", id, status).
+		Update("next_retry_at", nil).Error
+}
+
+// QueryExpiredAuthorizations loads authorized transactions expired before now
+func (r *repository) QueryExpiredAuthorizations(ctx context.Context, now time.Time, limit int) ([]Transaction, error) {
+	var transactions []Transaction
+	err := r.db.WithContext(ctx).
+		Where("transaction_status = ? AND expired_at < ?", Authorized, now).
+		Order("expired_at").
+		Limit(limit).
+		Find(&transactions).Error
+	return transactions, err
+}
+
+// ScheduleRetry counts a failed attempt of the transaction in status `from`, and sets when it's retried again.
+// It does nothing if the transaction is moved by others.
+func (r *repository) ScheduleRetry(ctx context.Context, id string, from model.TransactionStatus, nextRetryAt time.Time, lastError string) error {
+	return r.db.Model(&Transaction{}).
+		Where("transaction_id = ? AND transaction_status = ?", id, from).
+		Updates(map[string]interface{}{
+			"attempts":      gorm.Expr("attempts + 1"),
+			"next_retry_at": nextRetryAt,
+			"last_error":    lastError,
+		}).Error
+}
+
+// retryStatuses are the statuses retried by retry worker, confirm for Processing and cancel for the others
+var retryStatuses = []TransactionStatus{Pending, Processing, Voided, Revoked}
+
+// QueryDueRetryTransactions loads transactions whose next retry is due, legs of batch are retried with their batch.
+func (r *repository) QueryDueRetryTransactions(ctx context.Context, now time.Time, limit int) ([]Transaction, error) {
+	var transactions []Transaction
+	err := r.db.WithContext(ctx).
+		Where("transaction_status IN ? AND next_retry_at <= ? AND batch_id = ''", retryStatuses, now).
+		Order("next_retry_at").
+		Limit(limit).
+		Find(&transactions).Error
+	return transactions, err
+}
+
+// ClaimRetry moves next retry of a due transaction to leaseUntil, so only one worker retries it.
+// If the worker dies, the transaction is retried again after the lease.
+func (r *repository) ClaimRetry(ctx context.Context, id string, now, leaseUntil time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&Transaction{}).
+		Where("transaction_id = ? AND transaction_status IN ? AND next_retry_at <= ?", id, retryStatuses, now).
+		Update("next_retry_at", leaseUntil)
+	return result.RowsAffected == 1, result.Error
+}
+
+// transitStatus is a compare-and-set on transaction status, db should be a db transaction
+func transitStatus(ctx context.Context, db *gorm.DB, id string, from, to model.TransactionStatus, reason string) error {
+	return transitStatusWith(ctx, db, id, from, to, reason, nil)
+}
+
+// transitStatusWith is transitStatus saving other columns in updates together
+func transitStatusWith(ctx context.Context, db *gorm.DB, id string, from, to model.TransactionStatus, reason string, updates map[string]interface{}) error {
+	if !from.CanTransitTo(to) {
+		return &TransitionError{TransactionID: id, From: from, To: to, Current: from, Err: ErrIllegalTransition}
+	}
+	columns := map[string]interface{}{
+		"transaction_status": to,
+		// retry is not needed once status is moved
+		"next_retry_at": nil,
+	}
+	for column, value := range updates {
+		columns[column] = value
+	}
+	result := db.Model(&Transaction{}).
+		Where("transaction_id = ? AND transaction_status = ?", id, from).
+		Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var current Transaction
+		if err := db.Select("transaction_status").Where("transaction_id = ?", id).First(&current).Error; err != nil {
+			return err
+		}
+		return &TransitionError{TransactionID: id, From: from, To: to, Current: current.TransactionStatus, Err: ErrStatusChanged}
+	}
+	return createEvent(ctx, db, id, from, to, reason)
+}
+
+// QueryTransactionEvents loads status changes of the transaction from the oldest to the latest
+func (r *repository) QueryTransactionEvents(ctx context.Context, id string) ([]TransactionEvent, error) {
+	var events []TransactionEvent
+	if err := r.db.WithContext(ctx).Where("transaction_id = ?", id).Order("id").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// CreateBatch saves the batch, its approval if it needs approval, and all of its transactions in one db transaction
+func (r *repository) CreateBatch(ctx context.Context, batch Batch, transactions []Transaction) error {
+	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*2)
+	defer cancel()
+	return r.db.WithContext(ctxTimeout).Transaction(func(tx *gorm.DB) error {
+		batch.ExpiredAt = time.Now().Add(time.Minute * time.Duration(viper.GetInt(config.ConfigKeyTransactionExpiration)))
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		if batch.Approval != nil {
+			if err := tx.Create(batch.Approval).Error; err != nil {
+				return err
+			}
+		}
+		for _, transaction := range transactions {
+			if err := createTransaction(ctx, tx, transaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *repository) GetBatchByID(ctx context.Context, id string) (Batch, error) {
+	var batch Batch
+	if err := r.db.WithContext(ctx).Where("batch_id = ?", id).First(&batch).Error; err != nil {
+		return Batch{}, err
+	}
+	return batch, nil
+}
+
+func (r *repository) GetBatchTransactions(ctx context.Context, batchID string) ([]Transaction, error) {
+	var transactions []Transaction
+	if err := r.db.WithContext(ctx).Where("batch_id = ?", batchID).Order("id").Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// UpdateBatchStatus is a compare-and-set on batch status, ErrBatchStatusChanged indicates the batch is not in from any more
+func (r *repository) UpdateBatchStatus(ctx context.Context, id string, from, to model.TransactionStatus) error {
+	result := r.db.WithContext(ctx).Model(&Batch{}).Where("batch_id = ? AND batch_status = ?", id, from).Update("batch_status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBatchStatusChanged
+	}
+	return nil
+}
+
+// QueryExpiredBatches loads pending and processing batches passed expiration
+func (r *repository) QueryExpiredBatches(ctx context.Context) ([]Batch, error) {
+	var batches []Batch
+	if err := r.db.WithContext(ctx).Where("expired_at < ?", time.Now()).Where("batch_status in ?", []model.TransactionStatus{Pending, Processing}).Limit(200).Find(&batches).Error; err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+// QueryDueScheduledTransactions loads scheduled transactions whose execute_at is passed, earliest first
+func (r *repository) QueryDueScheduledTransactions(ctx context.Context, now time.Time, limit int) ([]Transaction, error) {
+	var transactions []Transaction
+	if err := r.db.WithContext(ctx).Where("transaction_status = ? AND execute_at <= ?", Scheduled, now).Order("execute_at").Limit(limit).Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// ClaimScheduledTransaction moves a due scheduled transaction to Pending and restarts its expiration.
+// false indicates the transaction is not scheduled, not due, or claimed by others.
+func (r *repository) ClaimScheduledTransaction(ctx context.Context, id string, now time.Time) (bool, error) {
+	var claimed bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Transaction{}).
+			Where("transaction_id = ? AND transaction_status = ? AND execute_at <= ?", id, Scheduled, now).
+			Updates(map[string]interface{}{
+				"transaction_status": Pending,
+				"expired_at":         now.Add(time.Minute * time.Duration(viper.GetInt(config.ConfigKeyTransactionExpiration))),
+			})
+		if claimed = result.RowsAffected == 1; !claimed || result.Error != nil {
+			return result.Error
+		}
+		return createEvent(ctx, tx, id, Scheduled, Pending, ReasonDue)
+	})
+	return claimed, err
+}
+
+// RevokeScheduledTransaction moves a scheduled transaction to Revoked.
+// false indicates the transaction is not scheduled, or it's already claimed.
+func (r *repository) RevokeScheduledTransaction(ctx context.Context, id string) (bool, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return transitStatus(ctx, tx, id, Scheduled, Revoked, ReasonRevoked)
+	})
+	if _, ok := asTransitionError(err); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RevokePendingTransaction moves a pending transaction to Revoked before its fund movement is canceled.
+// Cancel is retried at retryAt unless it's cleared by ClearRetry.
+func (r *repository) RevokePendingTransaction(ctx context.Context, id string, retryAt time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return transitStatusWith(ctx, tx, id, Pending, Revoked, ReasonRevoked, map[string]interface{}{
+			"next_retry_at": retryAt,
+		})
+	})
+}
+
+func (r *repository) GetApproval(ctx context.Context, id string) (Approval, error) {
+	var approval Approval
+	if err := r.db.WithContext(ctx).Where("transaction_id = ?", id).First(&approval).Error; err != nil {
+		return Approval{}, err
+	}
+	return approval, nil
+}
+
+// DecideApproval saves the decision of a pending approval and moves the transaction from AwaitingApproval to `to` in one db transaction.
+// A transaction moved to Pending restarts its expiration. ErrTransactionNotAwaitingApproval indicates the approval is decided by others.
+func (r *repository) DecideApproval(ctx context.Context, decision Approval, to model.TransactionStatus, reason string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := saveApprovalDecision(tx, decision); err != nil {
+			return err
+		}
+		return transitStatusWith(ctx, tx, decision.TransactionID, AwaitingApproval, to, reason, approvedUpdates(to))
+	})
+}
+
+// DecideBatchApproval saves the decision of a pending batch approval, and moves the batch and all of its legs from AwaitingApproval
+// to `to` in one db transaction. A batch moved to Pending restarts its expiration like its legs.
+func (r *repository) DecideBatchApproval(ctx context.Context, decision Approval, to model.TransactionStatus, reason string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := saveApprovalDecision(tx, decision); err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"batch_status": to}
+		for column, value := range approvedUpdates(to) {
+			updates[column] = value
+		}
+		result := tx.Model(&Batch{}).Where("batch_id = ? AND batch_status = ?", decision.BatchID, AwaitingApproval).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrBatchStatusChanged
+		}
+		var legs []Transaction
+		if err := tx.Where("batch_id = ?", decision.BatchID).Order("id").Find(&legs).Error; err != nil {
+			return err
+		}
+		for _, leg := range legs {
+			if err := transitStatusWith(ctx, tx, leg.TransactionID, AwaitingApproval, to, reason, approvedUpdates(to)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveApprovalDecision is a compare-and-set on a pending approval, ErrTransactionNotAwaitingApproval indicates it's decided by others
+func saveApprovalDecision(tx *gorm.DB, decision Approval) error {
+	result := tx.Model(&Approval{}).
+		Where("transaction_id = ? AND status = ?", decision.TransactionID, ApprovalPending).
+		Updates(map[string]interface{}{
+			"status":     decision.Status,
+			"decided_by": decision.DecidedBy,
+			"decided_at": decision.DecidedAt,
+			"note":       decision.Note,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTransactionNotAwaitingApproval
+	}
+	return nil
+}
+
+// approvedUpdates restarts the expiration of a transaction or batch moved to Pending by approval
+func approvedUpdates(to model.TransactionStatus) map[string]interface{} {
+	if to != Pending {
+		return nil
+	}
+	return map[string]interface{}{
+		"expired_at": time.Now().Add(time.Minute * time.Duration(viper.GetInt(config.ConfigKeyTransactionExpiration))),
+	}
+}
+
+// QueryExpiredApprovals loads pending approvals expired before now
+func (r *repository) QueryExpiredApprovals(ctx context.Context, now time.Time, limit int) ([]Approval, error) {
+	var approvals []Approval
+	err := r.db.WithContext(ctx).
+		Where("status = ? AND expired_at < ?", ApprovalPending, now).
+		Order("expired_at").
+		Limit(limit).
+		Find(&approvals).Error
+	return approvals, err
+}
+
+// riskIgnoredStatuses are statuses of transfers which never moved fund, they are not counted by risk rules
+var riskIgnoredStatuses = []TransactionStatus{Failed, Revoked, Rejected, Voided}
+
+// QueryTransferStats counts the transfers of source account created since query.Since, transfers never moved fund are ignored
+func (r *repository) QueryTransferStats(ctx context.Context, query TransferStatsQuery) (TransferStats, error) {
+	db := r.db.WithContext(ctx).Model(&Transaction{}).
+		Where("source_account_id = ? AND transaction_type = ?", query.SourceAccountID, model.Transfer).
+		Where("transaction_status NOT IN ?", riskIgnoredStatuses)
+	if query.DestinationAccountID != 0 {
+		db = db.Where("destination_account_id = ?", query.DestinationAccountID)
+	}
+	if !query.Since.IsZero() {
+		db = db.Where("created_at >= ?", query.Since)
+	}
+	var stats TransferStats
+	err := db.Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS total").Scan(&stats).Error
+	return stats, err
 }
 
 func (r *repository) Transaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
@@ -56,7 +569,7 @@ func (r *repository) Transaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOpti
 
 func (r *repository) QueryExpiredTransactions(ctx context.Context) ([]model.Transaction, error) {
 	var count int64
-	if err := r.db.Model(Transaction{}).Where("expired_at < ?", time.Now()).Where("transaction_status in ?", []model.TransactionStatus{Pending, Processing}).Count(&count).Error; err != nil {
+	if err := r.db.Model(Transaction{}).Where("expired_at < ?", time.Now()).Where("transaction_status in ?", []model.TransactionStatus{Pending, Processing}).Where("batch_id = '' AND next_retry_at IS NULL").Count(&count).Error; err != nil {
 		return nil, err
 	}
 
@@ -66,7 +579,9 @@ func (r *repository) QueryExpiredTransactions(ctx context.Context) ([]model.Tran
 
 	var transactions []model.Transaction
 
-	if err := r.db.Model(Transaction{}).Where("expired_at < ?", time.Now()).Where("transaction_status in ?", []model.TransactionStatus{Pending, Processing}).Offset(0).Limit(200).Find(&transactions).Error; err != nil {
+	// legs of batches are invalidated with their batch, see QueryExpiredBatches
+	// transactions waiting for retry are owned by retry worker, see QueryDueRetryTransactions
+	if err := r.db.Model(Transaction{}).Where("expired_at < ?", time.Now()).Where("transaction_status in ?", []model.TransactionStatus{Pending, Processing}).Where("batch_id = '' AND next_retry_at IS NULL").Offset(0).Limit(200).Find(&transactions).Error; err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,118 @@
+package transaction
+
+import (
+	"context"
+	"main/common/config"
+	"main/common/log"
+	"main/common/recovery"
+	"main/model"
+	"math/rand"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultRetryIntervalSeconds = 1
+	// MaxRetriesPerRun limits the due transactions retried by one worker run, the rest are retried in next runs
+	MaxRetriesPerRun = 200
+	// retryLease is how long a claimed retry is owned by a worker
+	retryLease        = time.Minute
+	defaultRetryBase  = 500 * time.Millisecond
+	defaultRetryLimit = 5 * time.Minute
+)
+
+// tccPhase is the TCC action being retried, backoff is configured per phase
+type tccPhase string
+
+const (
+	phaseConfirm tccPhase = "confirm"
+	phaseCancel  tccPhase = "cancel"
+)
+
+// isCancelDecided returns whether the transaction is moved to the status before its fund movement is canceled
+func isCancelDecided(status model.TransactionStatus) bool {
+	return status == model.Voided || status == model.Revoked
+}
+
+// retryBackoff returns the delay after the attempts th failure of the phase.
+// It's base * 2^(attempts-1) capped by max, and moved randomly by up to jitter of itself.
+func retryBackoff(phase tccPhase, attempts int) time.Duration {
+	key := config.ConfigKeyRetryBackoff + "." + string(phase)
+	base := time.Duration(viper.GetInt(key+".base_ms")) * time.Millisecond
+	if base <= 0 {
+		base = defaultRetryBase
+	}
+	limit := time.Duration(viper.GetInt(key+".max_ms")) * time.Millisecond
+	if limit <= 0 {
+		limit = defaultRetryLimit
+	}
+	delay := base
+	for i := 1; i < attempts && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	if jitter := viper.GetFloat64(key + ".jitter"); jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * jitter * float64(delay))
+	}
+	return delay
+}
+
+// scheduleRetry records a failed confirm or cancel of the transaction in status `from`, it's retried by retry worker after backoff,
+// or moved to ManualHandling once max_retries attempts are failed.
+// Legs of batch are not scheduled, they are driven again with their batch by invalidator.
+func (s *service) scheduleRetry(ctx context.Context, tx *model.Transaction, from model.TransactionStatus, phase tccPhase, cause error) {
+	if tx.BatchID != "" {
+		return
+	}
+	// moved by others, nothing to retry
+	if _, ok := asTransitionError(cause); ok {
+		return
+	}
+	attempts := tx.Attempts + 1
+	if attempts >= viper.GetInt(config.ConfigKeyMaxRetries) {
+		if err := s.repo.MarkManualHandling(ctx, tx.TransactionID, from, cause.Error()); err != nil {
+			log.GetSugger().Error("failed to move transaction to manual handling ", "transaction", tx.TransactionID, "err", err)
+		}
+		return
+	}
+	nextRetryAt := time.Now().Add(retryBackoff(phase, attempts))
+	if err := s.repo.ScheduleRetry(ctx, tx.TransactionID, from, nextRetryAt, cause.Error()); err != nil {
+		log.GetSugger().Error("failed to schedule retry ", "transaction", tx.TransactionID, "err", err)
+	}
+}
+
+// RetryDueTransactions confirms processing transactions and cancels pending transactions whose next retry is due.
+func (s *service) RetryDueTransactions(ctx context.Context, now time.Time) error {
+	transactions, err := s.repo.QueryDueRetryTransactions(ctx, now, MaxRetriesPerRun)
+	if err != nil {
+		return err
+	}
+	ctx = WithActor(ctx, ActorRetry)
+	for _, tx := range transactions {
+		claimed, err := s.repo.ClaimRetry(ctx, tx.TransactionID, now, now.Add(retryLease))
+		if err != nil {
+			log.GetSugger().Error("failed to claim retry ", "transaction", tx.TransactionID, "err", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		s.retryDue(ctx, tx)
+	}
+	return nil
+}
+
+func (s *service) retryDue(ctx context.Context, tx model.Transaction) {
+	defer recovery.RecoverAndLog()
+	tCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(viper.GetInt(config.ConfigKeyCreateTransactionTimeout)))
+	defer cancel()
+	switch tx.TransactionStatus {
+	case model.Processing:
+		_ = s.retryConfirm(tCtx, &tx)
+	case model.Pending, model.Voided, model.Revoked:
+		_ = s.retryCancel(tCtx, &tx, ReasonCancelRetried)
+	}
+}
@@ -0,0 +1,358 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/common/config"
+	"main/common/log"
+	"main/common/utils"
+	"main/model"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+type RiskDecision string
+
+const (
+	RiskAllow RiskDecision = "allow"
+	// RiskDeny rejects the transfer, it's not saved
+	RiskDeny RiskDecision = "deny"
+	// RiskReview saves the transfer in AwaitingApproval, it's processed after a second user approves it
+	RiskReview RiskDecision = "review"
+)
+
+// Types of built-in risk rules
+const (
+	RiskRuleBlocklist      = "blocklist"
+	RiskRuleVelocity       = "velocity"
+	RiskRuleNewDestination = "new_destination"
+	RiskRuleAmountOutlier  = "amount_outlier"
+)
+
+var (
+	// ErrRiskDenied indicates a risk rule denied the transfer
+	ErrRiskDenied = errors.New("denied by risk rules")
+	// ErrInvalidRiskRule indicates the risk rule in config can not be built
+	ErrInvalidRiskRule = errors.New("invalid risk rule")
+)
+
+// RiskDeniedError is the deny of a risk rule, Reason is returned to the client. It unwraps to ErrRiskDenied.
+type RiskDeniedError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *RiskDeniedError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrRiskDenied, e.Rule, e.Reason)
+}
+
+func (e *RiskDeniedError) Unwrap() error {
+	return ErrRiskDenied
+}
+
+// RiskResult is the decision of a risk rule on a transfer, Reason explains a deny or review
+type RiskResult struct {
+	Decision RiskDecision
+	Reason   string
+}
+
+// RiskRule checks a transfer before it's saved.
+// Evaluate should return an error only if the rule can not be checked, the transfer is not created then.
+type RiskRule interface {
+	Name() string
+	Evaluate(ctx context.Context, trx model.Transaction) (RiskResult, error)
+}
+
+// RiskHistory provides the past transfers to risk rules, it's implemented by Repository
+type RiskHistory interface {
+	QueryTransferStats(ctx context.Context, query TransferStatsQuery) (TransferStats, error)
+}
+
+// RiskRuleConfig is a rule in `risk.rules` of config. Type selects the rule, Decision is what the rule
+// decides when it's hit, and the other fields are parameters of the rule type.
+type RiskRuleConfig struct {
+	Type     string       `mapstructure:"type"`
+	Decision RiskDecision `mapstructure:"decision"`
+	// blocklist
+	Accounts []int `mapstructure:"accounts"`
+	// velocity
+	WindowMinutes int    `mapstructure:"window_minutes"`
+	MaxCount      int64  `mapstructure:"max_count"`
+	MaxAmount     string `mapstructure:"max_amount"`
+	// new_destination
+	MinAmount string `mapstructure:"min_amount"`
+	// amount_outlier
+	LookbackDays int     `mapstructure:"lookback_days"`
+	Multiplier   float64 `mapstructure:"multiplier"`
+	MinSamples   int64   `mapstructure:"min_samples"`
+}
+
+// RiskRuleFactory builds a rule from its config
+type RiskRuleFactory func(cfg RiskRuleConfig, history RiskHistory) (RiskRule, error)
+
+var riskRuleFactories = map[string]RiskRuleFactory{
+	RiskRuleBlocklist:      newBlocklistRule,
+	RiskRuleVelocity:       newVelocityRule,
+	RiskRuleNewDestination: newNewDestinationRule,
+	RiskRuleAmountOutlier:  newAmountOutlierRule,
+}
+
+// RegisterRiskRule makes a rule type usable in config, it should be called before NewService
+func RegisterRiskRule(ruleType string, factory RiskRuleFactory) {
+	riskRuleFactories[ruleType] = factory
+}
+
+// loadRiskRules builds the rules in config in order, it's called once by NewService
+func loadRiskRules(history RiskHistory) ([]RiskRule, error) {
+	var configs []RiskRuleConfig
+	if err := viper.UnmarshalKey(config.ConfigKeyRiskRules, &configs); err != nil {
+		return nil, ErrInvalidRiskRule
+	}
+	rules := make([]RiskRule, 0, len(configs))
+	for _, cfg := range configs {
+		factory, ok := riskRuleFactories[cfg.Type]
+		if !ok {
+			return nil, ErrInvalidRiskRule
+		}
+		rule, err := factory(cfg, history)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// checkRisk runs the risk rules on a transfer. A deny stops the chain and returns RiskDeniedError with the reason of the rule,
+// otherwise the transfer is reviewed if any rule asks for it. Every decision is logged, so rules can be tuned by their hits.
+func (s *service) checkRisk(ctx context.Context, trx model.Transaction) (RiskDecision, error) {
+	decision := RiskAllow
+	for _, rule := range s.riskRules {
+		result, err := rule.Evaluate(ctx, trx)
+		if err != nil {
+			log.GetSugger().Error("failed to evaluate risk rule ", "rule", rule.Name(), "transaction", trx.TransactionID, "err", err)
+			return "", err
+		}
+		log.GetSugger().Info("risk rule decision ", "rule", rule.Name(), "transaction", trx.TransactionID,
+			"source", trx.SourceAccountID, "destination", trx.DestinationAccountID, "amount", trx.Amount,
+			"decision", result.Decision, "reason", result.Reason)
+		if result.Decision == RiskDeny {
+			log.GetSugger().Info("risk decision ", "transaction", trx.TransactionID, "decision", RiskDeny)
+			return RiskDeny, &RiskDeniedError{Rule: rule.Name(), Reason: result.Reason}
+		}
+		if result.Decision == RiskReview {
+			decision = RiskReview
+		}
+	}
+	log.GetSugger().Info("risk decision ", "transaction", trx.TransactionID, "decision", decision)
+	return decision, nil
+}
+
+// hitDecision validates the decision of a rule when it's hit, empty decision is the default of the rule type
+func hitDecision(decision, defaultDecision RiskDecision) (RiskDecision, error) {
+	switch decision {
+	case "":
+		return defaultDecision, nil
+	case RiskDeny, RiskReview:
+		return decision, nil
+	default:
+		return "", ErrInvalidRiskRule
+	}
+}
+
+// parseRiskAmount parses a decimal string of risk rule into inflated value, empty string is 0
+func parseRiskAmount(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	inflatedValue, err := utils.ParseString(value)
+	if err != nil || inflatedValue < 0 {
+		return 0, ErrInvalidRiskRule
+	}
+	return inflatedValue, nil
+}
+
+// blocklistRule hits transfers from or to any of the accounts
+type blocklistRule struct {
+	accounts map[int]bool
+	decision RiskDecision
+}
+
+func newBlocklistRule(cfg RiskRuleConfig, _ RiskHistory) (RiskRule, error) {
+	decision, err := hitDecision(cfg.Decision, RiskDeny)
+	if err != nil {
+		return nil, err
+	}
+	rule := &blocklistRule{accounts: make(map[int]bool, len(cfg.Accounts)), decision: decision}
+	for _, accountID := range cfg.Accounts {
+		rule.accounts[accountID] = true
+	}
+	return rule, nil
+}
+
+func (r *blocklistRule) Name() string {
+	return RiskRuleBlocklist
+}
+
+func (r *blocklistRule) Evaluate(_ context.Context, trx model.Transaction) (RiskResult, error) {
+	for _, accountID := range []int{trx.SourceAccountID, trx.DestinationAccountID} {
+		if r.accounts[accountID] {
+			return RiskResult{Decision: r.decision, Reason: fmt.Sprintf("account %d is blocklisted", accountID)}, nil
+		}
+	}
+	return RiskResult{Decision: RiskAllow}, nil
+}
+
+// velocityRule hits when the transfers of source in the window, including this one, exceed MaxCount or MaxAmount.
+// Deposits and withdrawals are not checked, as only transfers are counted in the history.
+type velocityRule struct {
+	history   RiskHistory
+	window    time.Duration
+	maxCount  int64
+	maxAmount int64
+	decision  RiskDecision
+}
+
+func newVelocityRule(cfg RiskRuleConfig, history RiskHistory) (RiskRule, error) {
+	decision, err := hitDecision(cfg.Decision, RiskDeny)
+	if err != nil {
+		return nil, err
+	}
+	maxAmount, err := parseRiskAmount(cfg.MaxAmount)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.WindowMinutes <= 0 || cfg.MaxCount < 0 || (cfg.MaxCount == 0 && maxAmount == 0) {
+		return nil, ErrInvalidRiskRule
+	}
+	return &velocityRule{
+		history:   history,
+		window:    time.Minute * time.Duration(cfg.WindowMinutes),
+		maxCount:  cfg.MaxCount,
+		maxAmount: maxAmount,
+		decision:  decision,
+	}, nil
+}
+
+func (r *velocityRule) Name() string {
+	return RiskRuleVelocity
+}
+
+func (r *velocityRule) Evaluate(ctx context.Context, trx model.Transaction) (RiskResult, error) {
+	if trx.TransactionType != model.Transfer {
+		return RiskResult{Decision: RiskAllow}, nil
+	}
+	stats, err := r.history.QueryTransferStats(ctx, TransferStatsQuery{
+		SourceAccountID: trx.SourceAccountID,
+		Since:           time.Now().Add(-r.window),
+	})
+	if err != nil {
+		return RiskResult{}, err
+	}
+	if r.maxCount > 0 && stats.Count+1 > r.maxCount {
+		return RiskResult{Decision: r.decision, Reason: fmt.Sprintf("more than %d transfers in %s", r.maxCount, r.window)}, nil
+	}
+	if r.maxAmount > 0 && stats.Total+trx.Amount > r.maxAmount {
+		return RiskResult{Decision: r.decision, Reason: fmt.Sprintf("more than %s transferred in %s", utils.FormatInt(r.maxAmount), r.window)}, nil
+	}
+	return RiskResult{Decision: RiskAllow}, nil
+}
+
+// newDestinationRule hits the first transfer from source to destination, if the amount is at least MinAmount.
+// Deposits and withdrawals are not checked, their clearing account is never a destination of transfers.
+type newDestinationRule struct {
+	history   RiskHistory
+	minAmount int64
+	decision  RiskDecision
+}
+
+func newNewDestinationRule(cfg RiskRuleConfig, history RiskHistory) (RiskRule, error) {
+	decision, err := hitDecision(cfg.Decision, RiskReview)
+	if err != nil {
+		return nil, err
+	}
+	minAmount, err := parseRiskAmount(cfg.MinAmount)
+	if err != nil {
+		return nil, err
+	}
+	return &newDestinationRule{history: history, minAmount: minAmount, decision: decision}, nil
+}
+
+func (r *newDestinationRule) Name() string {
+	return RiskRuleNewDestination
+}
+
+func (r *newDestinationRule) Evaluate(ctx context.Context, trx model.Transaction) (RiskResult, error) {
+	if trx.TransactionType != model.Transfer || trx.Amount < r.minAmount {
+		return RiskResult{Decision: RiskAllow}, nil
+	}
+	stats, err := r.history.QueryTransferStats(ctx, TransferStatsQuery{
+		SourceAccountID:      trx.SourceAccountID,
+		DestinationAccountID: trx.DestinationAccountID,
+	})
+	if err != nil {
+		return RiskResult{}, err
+	}
+	if stats.Count == 0 {
+		return RiskResult{Decision: r.decision, Reason: fmt.Sprintf("first transfer to account %d", trx.DestinationAccountID)}, nil
+	}
+	return RiskResult{Decision: RiskAllow}, nil
+}
+
+// amountOutlierRule hits when the amount is more than Multiplier times the average transfer of source in the lookback days.
+// Sources with less than MinSamples transfers, deposits and withdrawals are not checked.
+type amountOutlierRule struct {
+	history    RiskHistory
+	lookback   time.Duration
+	multiplier float64
+	minSamples int64
+	decision   RiskDecision
+}
+
+func newAmountOutlierRule(cfg RiskRuleConfig, history RiskHistory) (RiskRule, error) {
+	decision, err := hitDecision(cfg.Decision, RiskReview)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.LookbackDays <= 0 || cfg.Multiplier <= 0 {
+		return nil, ErrInvalidRiskRule
+	}
+	minSamples := cfg.MinSamples
+	if minSamples <= 0 {
+		minSamples = 1
+	}
+	return &amountOutlierRule{
+		history:    history,
+		lookback:   time.Hour * 24 * time.Duration(cfg.LookbackDays),
+		multiplier: cfg.Multiplier,
+		minSamples: minSamples,
+		decision:   decision,
+	}, nil
+}
+
+func (r *amountOutlierRule) Name() string {
+	return RiskRuleAmountOutlier
+}
+
+func (r *amountOutlierRule) Evaluate(ctx context.Context, trx model.Transaction) (RiskResult, error) {
+	if trx.TransactionType != model.Transfer {
+		return RiskResult{Decision: RiskAllow}, nil
+	}
+	stats, err := r.history.QueryTransferStats(ctx, TransferStatsQuery{
+		SourceAccountID: trx.SourceAccountID,
+		Since:           time.Now().Add(-r.lookback),
+	})
+	if err != nil {
+		return RiskResult{}, err
+	}
+	if stats.Count < r.minSamples {
+		return RiskResult{Decision: RiskAllow}, nil
+	}
+	average := stats.Total / stats.Count
+	if float64(trx.Amount) > r.multiplier*float64(average) {
+		return RiskResult{Decision: r.decision, Reason: fmt.Sprintf("amount is more than %g times of average %s", r.multiplier, utils.FormatInt(average))}, nil
+	}
+	return RiskResult{Decision: RiskAllow}, nil
+}
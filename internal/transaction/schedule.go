@@ -0,0 +1,131 @@
+package transaction
+
+import (
+	"context"
+	"errors"
+	"main/common/config"
+	"main/model"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultScheduleIntervalSeconds = 5
+	// MaxScheduledTransactionsPerRun limits the due transactions started by one scheduler run, the rest are started in next runs
+	MaxScheduledTransactionsPerRun = 200
+)
+
+var (
+	// ErrInvalidExecuteAt indicates execute_at of a scheduled transaction is not in the future
+	ErrInvalidExecuteAt = errors.New("invalid execute at")
+	// ErrTransactionNotScheduled indicates the transaction is not scheduled, or it's already started
+	ErrTransactionNotScheduled = errors.New("transaction not scheduled")
+	// ErrTransactionNotCancelable indicates the transaction is already final, or it's not a transfer canceled alone like a leg of batch
+	ErrTransactionNotCancelable = errors.New("transaction not cancelable")
+	// ErrTransactionConfirmed indicates the transaction is confirmed or being confirmed, it can only be refunded
+	ErrTransactionConfirmed = errors.New("transaction confirmed")
+	ErrUserRequired         = errors.New("user required")
+	// ErrNotTransactionSender indicates the user canceling the transaction is not the user created it
+	ErrNotTransactionSender = errors.New("not transaction sender")
+	// ErrTransactionWithoutCreator indicates the transaction is created without user, nobody can prove to be its sender to cancel it
+	ErrTransactionWithoutCreator = errors.New("transaction without creator")
+)
+
+// ExecuteScheduledTransaction moves a due scheduled transaction to Pending and processes it as a normal transaction.
+// Only one caller can claim the transaction, others get ErrTransactionNotScheduled.
+func (s *service) ExecuteScheduledTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error) {
+	claimed, err := s.repo.ClaimScheduledTransaction(ctx, req.TransactionID, time.Now())
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	if !claimed {
+		return model.Transaction{}, ErrTransactionNotScheduled
+	}
+	tx, err := s.repo.GetTransactionByID(ctx, req.TransactionID)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+
+	trxChan, err := s.processTransaction(ctx, &tx)
+	if trx, ok := <-trxChan; ok {
+		return trx, err
+	}
+	return tx, err
+}
+
+// CancelTransaction revokes a transaction awaiting approval or a scheduled transaction before it's started,
+// or a pending transaction before it's confirmed.
+// A pending transaction is moved to Revoked before Cancel, so a concurrent processing can not move it to Processing any more,
+// and its Try after the Cancel is rejected by the empty rollback.
+// Only the user created the transaction can cancel it, a transaction created without user can not be canceled.
+func (s *service) CancelTransaction(ctx context.Context, req CancelTransactionRequest) (model.Transaction, error) {
+	if req.UserID == "" {
+		return model.Transaction{}, ErrUserRequired
+	}
+	tx, err := s.repo.GetTransactionByID(ctx, req.TransactionID)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	if tx.CreatedBy == "" {
+		return model.Transaction{}, ErrTransactionWithoutCreator
+	}
+	if tx.CreatedBy != req.UserID {
+		return model.Transaction{}, ErrNotTransactionSender
+	}
+	if tx.TransactionStatus == model.AwaitingApproval {
+		approval, err := s.repo.GetApproval(ctx, tx.TransactionID)
+		if err != nil {
+			return tx, err
+		}
+		err = s.decideApproval(ctx, approval, "", "", model.ApprovalCanceled, model.Revoked, ReasonRevoked)
+		if err == nil {
+			return s.queryWithApproval(ctx, tx.TransactionID)
+		}
+		if err != ErrTransactionNotAwaitingApproval {
+			return tx, err
+		}
+		// decided by others, cancel it by its latest status
+		if tx, err = s.repo.GetTransactionByID(ctx, tx.TransactionID); err != nil {
+			return model.Transaction{}, err
+		}
+	}
+	if tx.TransactionStatus == model.Scheduled {
+		revoked, err := s.repo.RevokeScheduledTransaction(ctx, tx.TransactionID)
+		if err != nil {
+			return tx, err
+		}
+		if revoked {
+			return s.repo.GetTransactionByID(ctx, tx.TransactionID)
+		}
+		// claimed by scheduler, cancel it as a pending transaction
+		if tx, err = s.repo.GetTransactionByID(ctx, tx.TransactionID); err != nil {
+			return model.Transaction{}, err
+		}
+	}
+	if tx.TransactionStatus != model.Pending || tx.BatchID != "" {
+		return tx, cancelConflict(tx.TransactionStatus)
+	}
+
+	if err := s.repo.RevokePendingTransaction(ctx, tx.TransactionID, time.Now().Add(retryLease)); err != nil {
+		if transitionErr, ok := asTransitionError(err); ok {
+			return tx, cancelConflict(transitionErr.Current)
+		}
+		return tx, err
+	}
+	tx.TransactionStatus = model.Revoked
+
+	tCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(viper.GetInt(config.ConfigKeyCreateTransactionTimeout)))
+	defer cancel()
+	_ = s.retryCancel(tCtx, &tx, ReasonRevoked)
+	return s.repo.GetTransactionByID(ctx, tx.TransactionID)
+}
+
+// cancelConflict returns why a transaction in the status can not be canceled
+func cancelConflict(status model.TransactionStatus) error {
+	switch status {
+	case model.Processing, model.Fulfiled, model.PartiallyRefunded, model.Refunded:
+		return ErrTransactionConfirmed
+	}
+	return ErrTransactionNotCancelable
+}
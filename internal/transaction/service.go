@@ -2,76 +2,387 @@ package transaction
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"main/common/config"
 	"main/common/log"
 	"main/common/recovery"
 	"main/common/utils"
 	"main/internal/account"
 	"main/model"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 const (
 	DefaultCreateTransactionTimeoutSeconds = 3
 	DefaultTryTransactionTimeoutSeconds    = 1
 	MaxRetry                               = 3
+	MaxIdempotencyKeyLength                = 255
 )
 
 var (
 	ErrSameAccountTransactions = errors.New("source and destination cannot be the same")
+	ErrInvalidSender           = errors.New("invalid sender")
+	ErrInvalidReciever         = errors.New("invalid reciever")
+	ErrInvalidAmount           = errors.New("invalid amount")
+	// ErrClearingAccountNotAllowed indicates clearing account is used in a transfer, or as the account of deposit and withdrawal
+	ErrClearingAccountNotAllowed = errors.New("clearing account not allowed")
+	// ErrClearingAccountNotFound indicates there is no clearing account configured for the currency
+	ErrClearingAccountNotFound = errors.New("clearing account not found")
+	// ErrIdempotencyKeyReused indicates the idempotency key is used by a request with different parameters
+	ErrIdempotencyKeyReused     = errors.New("idempotency key reused")
+	ErrDuplicatedIdempotencyKey = errors.New("duplicated idempotency key")
+	ErrInvalidIdempotencyKey    = errors.New("invalid idempotency key")
+	// ErrClientIDRequired indicates the idempotency key is given without client, keys are scoped per client
+	ErrClientIDRequired = errors.New("client id required")
+	// ErrTransactionNotRefundable indicates the transaction is not a fulfiled or partially refunded transfer
+	ErrTransactionNotRefundable = errors.New("transaction not refundable")
+	// ErrRefundExceedsAmount indicates the refunds in progress or done would exceed the amount of original transaction
+	ErrRefundExceedsAmount = errors.New("refund exceeds amount")
 )
 
 type Service interface {
 	CreateTransaction(ctx context.Context, req CreateTransactionRequest) (model.Transaction, error)
 	QueryTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error)
+	QueryTransactionEvents(ctx context.Context, req QueryTransactionRequest) ([]model.TransactionEvent, error)
+	ListManualTransactions(ctx context.Context, req ListTransactionsRequest) ([]model.Transaction, string, error)
+	ResolveTransaction(ctx context.Context, req ResolveTransactionRequest) (model.Transaction, error)
+	RetryDueTransactions(ctx context.Context, now time.Time) error
+	WaitTransaction(ctx context.Context, req WaitTransactionRequest) (model.Transaction, error)
+	ListTransactions(ctx context.Context, req ListTransactionsRequest) ([]model.Transaction, string, error)
 	RetryTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error)
-
-	// ConfirmTransaction(req ConfirmTransactionRequest) error
+	CreateDeposit(ctx context.Context, req FundingRequest) (model.Transaction, error)
+	CreateWithdrawal(ctx context.Context, req FundingRequest) (model.Transaction, error)
+	CreateRefund(ctx context.Context, req RefundRequest) (model.Transaction, error)
+	CreateBatch(ctx context.Context, req CreateBatchRequest) (model.Batch, error)
+	QueryBatch(ctx context.Context, req QueryBatchRequest) (model.Batch, error)
+	InvalidateBatch(ctx context.Context, req QueryBatchRequest) (model.Batch, error)
+	InvalidateTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error)
+	ExecuteScheduledTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error)
+	CancelTransaction(ctx context.Context, req CancelTransactionRequest) (model.Transaction, error)
+	ConfirmTransaction(ctx context.Context, req ConfirmTransactionRequest) (model.Transaction, error)
+	VoidTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error)
+	ExpireAuthorizations(ctx context.Context, now time.Time) error
+	ApproveTransaction(ctx context.Context, req ApprovalRequest) (model.Transaction, error)
+	RejectTransaction(ctx context.Context, req ApprovalRequest) (model.Transaction, error)
+	ApproveBatch(ctx context.Context, req BatchApprovalRequest) (model.Batch, error)
+	RejectBatch(ctx context.Context, req BatchApprovalRequest) (model.Batch, error)
+	QueryApproval(ctx context.Context, req QueryTransactionRequest) (model.Approval, error)
+	ExpireApprovals(ctx context.Context, now time.Time) error
+	RelayOutbox(ctx context.Context) error
 }
 
 type service struct {
 	repo        Repository
 	accountTCC  account.TCC
 	accountRepo account.AccountRepository
+	asyncPool   *workerPool
+	riskRules   []RiskRule
 }
 
-func NewService(repo Repository, accountTCC account.TCC, accountRepo account.AccountRepository) Service {
-	return &service{repo: repo, accountTCC: accountTCC, accountRepo: accountRepo}
+// NewService returns an error if the risk rules in config can not be built, so a bad config fails the boot instead of every transfer
+func NewService(repo Repository, accountTCC account.TCC, accountRepo account.AccountRepository) (Service, error) {
+	riskRules, err := loadRiskRules(repo)
+	if err != nil {
+		return nil, err
+	}
+	s := &service{repo: repo, accountTCC: accountTCC, accountRepo: accountRepo, riskRules: riskRules}
+	s.asyncPool = newWorkerPool(s.processAsync)
+	return s, nil
 }
 
 func (s *service) CreateTransaction(ctx context.Context, req CreateTransactionRequest) (model.Transaction, error) {
 	if req.DestinationAccountID == req.SourceAccountID {
 		return model.Transaction{}, ErrSameAccountTransactions
 	}
-	inflatedValue, err := utils.ParseString(req.Amount)
+	inflatedValue, err := ParseAmount(req.Amount)
 	if err != nil {
 		return model.Transaction{}, err
 	}
 
-	if _, err := s.accountRepo.GetAccountByID(ctx, req.SourceAccountID); err != nil {
+	var idempotencyKey *model.IdempotencyKey
+	if req.IdempotencyKey != "" {
+		if len(req.IdempotencyKey) > MaxIdempotencyKeyLength {
+			return model.Transaction{}, ErrInvalidIdempotencyKey
+		}
+		if req.ClientID == "" {
+			return model.Transaction{}, ErrClientIDRequired
+		}
+		idempotencyKey = &model.IdempotencyKey{
+			ClientID:       req.ClientID,
+			IdempotencyKey: req.IdempotencyKey,
+			RequestHash:    fingerprint(req.SourceAccountID, req.DestinationAccountID, inflatedValue, req.Currency, req.ExecuteAt, isManualCapture(req)),
+		}
+		// replay the transaction created by the first request
+		if trx, err := s.replayIdempotencyKey(ctx, *idempotencyKey); err != gorm.ErrRecordNotFound {
+			return trx, err
+		}
+	}
+	if req.ExecuteAt != nil && !req.ExecuteAt.After(time.Now()) {
+		return model.Transaction{}, ErrInvalidExecuteAt
+	}
+
+	sourceAcc, err := s.accountRepo.GetAccountByID(ctx, req.SourceAccountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Transaction{}, ErrInvalidSender
+		}
 		return model.Transaction{}, err
 	}
 
-	if _, err := s.accountRepo.GetAccountByID(ctx, req.DestinationAccountID); err != nil {
+	destAcc, err := s.accountRepo.GetAccountByID(ctx, req.DestinationAccountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Transaction{}, ErrInvalidReciever
+		}
 		return model.Transaction{}, err
 	}
 
+	// Clearing accounts can only be used by deposits and withdrawals
+	if sourceAcc.IsClearing() || destAcc.IsClearing() {
+		return model.Transaction{}, ErrClearingAccountNotAllowed
+	}
+
+	// Transfer is only allowed between accounts with the same currency. Currency in request is optional,
+	// if it's given, it must match the accounts' currency.
+	if sourceAcc.Currency != destAcc.Currency {
+		return model.Transaction{}, account.ErrCurrencyMismatch
+	}
+	if req.Currency != "" && !strings.EqualFold(strings.TrimSpace(req.Currency), sourceAcc.Currency) {
+		return model.Transaction{}, account.ErrCurrencyMismatch
+	}
+
 	trx := model.Transaction{
 		SourceAccountID:      req.SourceAccountID,
 		DestinationAccountID: req.DestinationAccountID,
 		Amount:               inflatedValue,
+		Currency:             sourceAcc.Currency,
+		TransactionID:        utils.GenerateTransactionID(),
+		TransactionStatus:    model.Pending,
+		TransactionType:      model.Transfer,
+		StandingOrderID:      req.StandingOrderID,
+		ManualCapture:        isManualCapture(req),
+		CreatedBy:            req.RequestedBy,
+	}
+	if err := applyFee(&trx); err != nil {
+		return model.Transaction{}, err
+	}
+	risk, err := s.checkRisk(ctx, trx)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	create := s.repo.CreateTransaction
+	if idempotencyKey != nil {
+		create = func(ctx context.Context, trx model.Transaction) error {
+			return s.repo.CreateTransactionWithIdempotencyKey(ctx, trx, *idempotencyKey)
+		}
+	}
+	if req.ExecuteAt != nil {
+		executeAt := req.ExecuteAt.UTC()
+		trx.ExecuteAt = &executeAt
+	}
+	needApproval, err := requiresApproval(trx.Currency, trx.Amount)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	// Transfer above approval threshold or sent to review by risk rules is only saved, it's processed or scheduled after a second user approves it
+	if needApproval || risk == RiskReview {
+		if req.RequestedBy == "" {
+			return model.Transaction{}, ErrRequesterRequired
+		}
+		trx.TransactionStatus = model.AwaitingApproval
+		trx.Approval = newApproval(trx.TransactionID, req.RequestedBy)
+		if err = create(ctx, trx); err != nil {
+			trx = model.Transaction{}
+		}
+	} else if trx.ExecuteAt != nil {
+		// Scheduled transaction is only saved, it will be processed by scheduler at ExecuteAt
+		trx.TransactionStatus = model.Scheduled
+		if err = create(ctx, trx); err != nil {
+			trx = model.Transaction{}
+		}
+	} else if req.Async {
+		trx, err = s.enqueueTransaction(ctx, trx, create)
+	} else {
+		trx, err = s.startTransaction(ctx, trx, create)
+	}
+	// the same key is used by a concurrent request
+	if err == ErrDuplicatedIdempotencyKey {
+		return s.replayIdempotencyKey(ctx, *idempotencyKey)
+	}
+	return trx, err
+}
+
+// replayIdempotencyKey returns the transaction created with the idempotency key.
+// gorm.ErrRecordNotFound indicates the key is not used yet.
+func (s *service) replayIdempotencyKey(ctx context.Context, key model.IdempotencyKey) (model.Transaction, error) {
+	existing, err := s.repo.GetIdempotencyKey(ctx, key.ClientID, key.IdempotencyKey)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	if existing.RequestHash != key.RequestHash {
+		return model.Transaction{}, ErrIdempotencyKeyReused
+	}
+	log.GetSugger().Info("replay idempotency key", "clientID", key.ClientID, "key", key.IdempotencyKey, "transactionID", existing.TransactionID)
+	return s.repo.GetTransactionByID(ctx, existing.TransactionID)
+}
+
+// fingerprint hashes the normalized transfer request
+func fingerprint(sourceAccountID, destinationAccountID int, amount int64, currency string, executeAt *time.Time, manualCapture bool) string {
+	request := fmt.Sprintf("%d|%d|%d|%s", sourceAccountID, destinationAccountID, amount, strings.ToUpper(strings.TrimSpace(currency)))
+	if executeAt != nil {
+		request += fmt.Sprintf("|%d", executeAt.UnixNano())
+	}
+	if manualCapture {
+		request += "|authorize"
+	}
+	sum := sha256.Sum256([]byte(request))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateDeposit moves fund from the clearing account of account's currency into the account
+func (s *service) CreateDeposit(ctx context.Context, req FundingRequest) (model.Transaction, error) {
+	inflatedValue, err := ParseAmount(req.Amount)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	acc, clearingAccountID, err := s.loadFundingAccounts(ctx, req, ErrInvalidReciever)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+
+	return s.startFunding(ctx, model.Transaction{
+		SourceAccountID:      clearingAccountID,
+		DestinationAccountID: acc.AccountID,
+		Amount:               inflatedValue,
+		Currency:             acc.Currency,
 		TransactionID:        utils.GenerateTransactionID(),
 		TransactionStatus:    model.Pending,
+		TransactionType:      model.Deposit,
+		CreatedBy:            req.RequestedBy,
+	})
+}
+
+// CreateWithdrawal moves fund from the account to the clearing account of account's currency
+func (s *service) CreateWithdrawal(ctx context.Context, req FundingRequest) (model.Transaction, error) {
+	inflatedValue, err := ParseAmount(req.Amount)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	acc, clearingAccountID, err := s.loadFundingAccounts(ctx, req, ErrInvalidSender)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+
+	return s.startFunding(ctx, model.Transaction{
+		SourceAccountID:      acc.AccountID,
+		DestinationAccountID: clearingAccountID,
+		Amount:               inflatedValue,
+		Currency:             acc.Currency,
+		TransactionID:        utils.GenerateTransactionID(),
+		TransactionStatus:    model.Pending,
+		TransactionType:      model.Withdrawal,
+		CreatedBy:            req.RequestedBy,
+	})
+}
+
+// startFunding runs risk rules on a deposit or withdrawal before it's saved.
+// A funding sent for review is only saved in AwaitingApproval like a transfer, it's processed after a second user approves it.
+func (s *service) startFunding(ctx context.Context, trx model.Transaction) (model.Transaction, error) {
+	risk, err := s.checkRisk(ctx, trx)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	if risk == RiskReview {
+		if trx.CreatedBy == "" {
+			return model.Transaction{}, ErrRequesterRequired
+		}
+		trx.TransactionStatus = model.AwaitingApproval
+		trx.Approval = newApproval(trx.TransactionID, trx.CreatedBy)
+		if err := s.repo.CreateTransaction(ctx, trx); err != nil {
+			return model.Transaction{}, err
+		}
+		return trx, nil
 	}
+	return s.startTransaction(ctx, trx, s.repo.CreateTransaction)
+}
+
+// CreateRefund moves fund from destination back to source of a fulfiled transfer.
+// Every refund is a separated transaction linked to the original one by OriginalTransactionID.
+func (s *service) CreateRefund(ctx context.Context, req RefundRequest) (model.Transaction, error) {
+	original, err := s.repo.GetTransactionByID(ctx, req.TransactionID)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	if !isRefundable(original) {
+		return model.Transaction{}, ErrTransactionNotRefundable
+	}
+	var inflatedValue int64
+	if req.Amount != "" {
+		if inflatedValue, err = ParseAmount(req.Amount); err != nil {
+			return model.Transaction{}, err
+		}
+	} else {
+		refunded, err := s.repo.SumRefundAmount(ctx, original.TransactionID)
+		if err != nil {
+			return model.Transaction{}, err
+		}
+		if inflatedValue = original.Amount - refunded; inflatedValue <= 0 {
+			return model.Transaction{}, ErrRefundExceedsAmount
+		}
+	}
+
+	// Refundable amount is checked again when saving the refund, so concurrent refunds can not exceed original amount
+	return s.startTransaction(ctx, model.Transaction{
+		SourceAccountID:       original.DestinationAccountID,
+		DestinationAccountID:  original.SourceAccountID,
+		Amount:                inflatedValue,
+		Currency:              original.Currency,
+		TransactionID:         utils.GenerateTransactionID(),
+		TransactionStatus:     model.Pending,
+		TransactionType:       model.Refund,
+		OriginalTransactionID: original.TransactionID,
+	}, s.repo.CreateRefund)
+}
+
+func isRefundable(trx model.Transaction) bool {
+	return trx.TransactionType == model.Transfer &&
+		(trx.TransactionStatus == model.Fulfiled || trx.TransactionStatus == model.PartiallyRefunded)
+}
+
+// loadFundingAccounts loads the user account of a deposit or withdrawal and finds the clearing account id by its currency
+func (s *service) loadFundingAccounts(ctx context.Context, req FundingRequest, errNotFound error) (model.Account, int, error) {
+	acc, err := s.accountRepo.GetAccountByID(ctx, int(req.AccountID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Account{}, 0, errNotFound
+		}
+		return model.Account{}, 0, err
+	}
+	if acc.IsClearing() {
+		return model.Account{}, 0, ErrClearingAccountNotAllowed
+	}
+	clearingAccountID := viper.GetInt(config.ConfigKeyClearingAccounts + "." + acc.Currency)
+	if clearingAccountID == 0 {
+		return model.Account{}, 0, ErrClearingAccountNotFound
+	}
+	return acc, clearingAccountID, nil
+}
+
+// startTransaction saves the pending transaction with create, and waits for it goes to final status until timeout.
+func (s *service) startTransaction(ctx context.Context, trx model.Transaction, create func(ctx context.Context, trx model.Transaction) error) (model.Transaction, error) {
 	timeoutSeconds := viper.GetInt(config.ConfigKeyCreateTransactionTimeout)
 	tCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(timeoutSeconds))
 	defer cancel()
 	// Create pending transaction
-	err = s.repo.CreateTransaction(tCtx, trx)
+	err := create(tCtx, trx)
 	if err != nil {
 		return model.Transaction{}, err
 	}
@@ -93,6 +404,83 @@ func (s *service) QueryTransaction(ctx context.Context, req QueryTransactionRequ
 	return s.repo.GetTransactionByID(ctx, req.TransactionID)
 }
 
+// InvalidateTransaction pushes an expired transaction to final status. A pending transaction may be partially tried, so it's canceled.
+// A processing transaction has its try succeeded and is decided to be confirmed, so it's confirmed again and never canceled,
+// it goes to ManualHandling if confirm keeps failing.
+func (s *service) InvalidateTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error) {
+	tx, err := s.repo.GetTransactionByID(ctx, req.TransactionID)
+	if err != nil {
+		return model.Transaction{}, err
+	}
+	switch tx.TransactionStatus {
+	case model.Pending:
+		err = s.retryCancel(ctx, &tx, ReasonExpired)
+	case model.Processing:
+		err = s.retryConfirm(ctx, &tx)
+	default:
+		return tx, nil
+	}
+	if err != nil {
+		return tx, err
+	}
+	return s.repo.GetTransactionByID(ctx, tx.TransactionID)
+}
+
+// ListTransactions returns a page of transactions matching the filters, and the cursor of next page if there is one.
+func (s *service) ListTransactions(ctx context.Context, req ListTransactionsRequest) ([]model.Transaction, string, error) {
+	query := TransactionQuery{
+		AccountID:            req.AccountID,
+		SourceAccountID:      req.SourceAccountID,
+		DestinationAccountID: req.DestinationAccountID,
+		From:                 req.From,
+		To:                   req.To,
+		Limit:                req.Limit,
+	}
+	for _, status := range req.Status {
+		query.Statuses = append(query.Statuses, model.TransactionStatus(status))
+	}
+	var err error
+	if req.MinAmount != "" {
+		if query.MinAmount, err = ParseAmount(req.MinAmount); err != nil {
+			return nil, "", err
+		}
+	}
+	if req.MaxAmount != "" {
+		if query.MaxAmount, err = ParseAmount(req.MaxAmount); err != nil {
+			return nil, "", err
+		}
+	}
+	if query.MaxAmount != 0 && query.MinAmount > query.MaxAmount {
+		return nil, "", errInvalidParams
+	}
+	if query.Limit <= 0 {
+		query.Limit = DefaultListLimit
+	}
+	if query.Limit > MaxListLimit {
+		query.Limit = MaxListLimit
+	}
+	if req.Cursor != "" {
+		beforeTime, beforeID, err := utils.DecodeCursor(req.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		query.BeforeTime, query.BeforeID = beforeTime, uint(beforeID)
+	}
+
+	// load one more transaction to know if there is a next page
+	query.Limit++
+	transactions, err := s.repo.QueryTransactions(ctx, query)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(transactions) < query.Limit {
+		return transactions, "", nil
+	}
+	transactions = transactions[:len(transactions)-1]
+	last := transactions[len(transactions)-1]
+	return transactions, utils.EncodeCursor(last.CreatedAt, int(last.ID)), nil
+}
+
 // TODO: Better expose this as a cmd, not a http request
 func (s *service) RetryTransaction(ctx context.Context, req QueryTransactionRequest) (model.Transaction, error) {
 	tx, err := s.repo.GetTransactionByID(ctx, req.TransactionID)
@@ -101,8 +489,22 @@ func (s *service) RetryTransaction(ctx context.Context, req QueryTransactionRequ
 	}
 	tCtx, cancel := context.WithTimeout(ctx, time.Second*DefaultCreateTransactionTimeoutSeconds)
 	defer cancel()
+	// All tries of a processing transaction succeeded, confirm it again
+	if tx.TransactionStatus == model.Processing {
+		if err := s.retryConfirm(tCtx, &tx); err != nil {
+			return tx, err
+		}
+		return s.repo.GetTransactionByID(ctx, tx.TransactionID)
+	}
+	// Cancel of the transaction failed before, keep canceling instead of trying it
+	if (tx.TransactionStatus == model.Pending || isCancelDecided(tx.TransactionStatus)) && tx.NextRetryAt != nil {
+		if err := s.retryCancel(tCtx, &tx, ReasonCancelRetried); err != nil {
+			return tx, err
+		}
+		return s.repo.GetTransactionByID(ctx, tx.TransactionID)
+	}
 	// Start from try
-	if tx.TransactionStatus == model.Pending || tx.TransactionStatus == model.Processing {
+	if tx.TransactionStatus == model.Pending {
 		trxChan, err := s.processTransaction(tCtx, &tx)
 
 		select {
@@ -130,69 +532,109 @@ func (s *service) processTransaction(ctx context.Context, transaction *model.Tra
 				transactionChan <- tx
 			}
 		}()
-		defer recovery.GoRecovery()
+		defer recovery.RecoverAndLog()
 
-		transaction.Retries = viper.GetInt(config.ConfigKeyMaxRetries)
 		if err != nil {
 			if errors.Is(err, context.DeadlineExceeded) {
-				s.retryCancel(ctx, transaction)
-			} else {
-				_ = s.repo.UpdateTransactionStatus(ctx, transaction.TransactionID, model.Failed)
+				_ = s.retryCancel(ctx, transaction, ReasonTryTimeout)
+			} else if err := s.repo.TransitTransactionStatus(ctx, transaction.TransactionID, model.Pending, model.Failed, err.Error()); err != nil {
+				log.GetSugger().Error("failed to fail transaction ", "transaction", transaction.TransactionID, "err", err)
 			}
 			return
 		}
 
-		_ = s.repo.UpdateTransactionStatus(ctx, transaction.TransactionID, model.Processing)
+		// Fund is held until client captures or voids it
+		if transaction.ManualCapture {
+			if err := s.repo.AuthorizeTransaction(ctx, transaction.TransactionID, authorizationExpiredAt()); err != nil {
+				log.GetSugger().Error("failed to authorize transaction ", "transaction", transaction.TransactionID, "err", err)
+			}
+			return
+		}
+
+		// Only the one moved transaction to Processing confirms it, e.g. it may be invalidated during try
+		if err := s.repo.TransitTransactionStatus(ctx, transaction.TransactionID, model.Pending, model.Processing, ReasonTried); err != nil {
+			log.GetSugger().Error("failed to move transaction to processing ", "transaction", transaction.TransactionID, "err", err)
+			return
+		}
 
-		s.retryConfirm(ctx, transaction)
+		_ = s.retryConfirm(ctx, transaction)
 	}()
 
 	return transactionChan, err
 }
 
-func (s *service) retryCancel(ctx context.Context, tx *model.Transaction) {
+// retryCancel cancels a pending transaction and moves it to Failed with reason, or releases fund of a voided or revoked transaction.
+// If cancel fails, the transaction is retried later by retry worker, see scheduleRetry.
+func (s *service) retryCancel(ctx context.Context, tx *model.Transaction, reason string) error {
 	log.GetSugger().Info("start to cancel transaction ", "transaction", tx)
-	var err error
-	for i := 0; i < tx.Retries; i++ {
-		log.GetSugger().Info("call cancel ", "transaction", tx.TransactionID, "err", err)
-		err = s.accountTCC.Cancel(ctx, tx.TransactionID)
-		log.GetSugger().Info("try cancel ", "transaction", tx.TransactionID, "err", err)
-		if err == nil || err == account.ErrEmptyRollback {
-			if err = s.repo.UpdateTransactionStatus(ctx, tx.TransactionID, model.Failed); err == nil {
-				return
+	err := s.accountTCC.Cancel(ctx, tx.TransactionID)
+	log.GetSugger().Info("try cancel ", "transaction", tx.TransactionID, "err", err)
+	if err == nil || err == account.ErrEmptyRollback {
+		if isCancelDecided(tx.TransactionStatus) {
+			// status is moved before cancel, only the retry is left
+			err = s.repo.ClearRetry(ctx, tx.TransactionID, tx.TransactionStatus)
+		} else {
+			err = s.repo.TransitTransactionStatus(ctx, tx.TransactionID, model.Pending, model.Failed, reason)
+			if isAppliedByRelay(err, model.Failed) {
+				err = nil
 			}
 		}
-		time.Sleep(30 * time.Millisecond)
 	}
 	if err != nil {
 		log.GetSugger().Error("failed to cancel transaction ", "transaction", tx, "err", err)
+		s.scheduleRetry(ctx, tx, tx.TransactionStatus, phaseCancel, err)
 	}
-
+	return err
 }
 
-func (s *service) retryConfirm(ctx context.Context, tx *model.Transaction) {
+// retryConfirm confirms a processing transaction and moves it to Fulfiled.
+// If confirm fails, the transaction is retried later by retry worker, see scheduleRetry.
+func (s *service) retryConfirm(ctx context.Context, tx *model.Transaction) error {
 	log.GetLogger().With(zap.Any("transaction", tx)).Info("prepare to confirm")
-	var err error
-	for i := 0; i < tx.Retries; i++ {
-		err = s.accountTCC.Confirm(ctx, tx.TransactionID)
-		if err == nil {
-			if err = s.repo.UpdateTransactionStatus(ctx, tx.TransactionID, model.Fulfiled); err == nil {
-				return
-			}
+	err := s.accountTCC.Confirm(ctx, tx.TransactionID)
+	if err == nil {
+		if err = s.repo.TransitTransactionStatus(ctx, tx.TransactionID, model.Processing, model.Fulfiled, ReasonConfirmed); err == nil {
+			s.settleRefund(ctx, tx)
+			return nil
+		}
+		// refund is settled by outbox relay too
+		if isAppliedByRelay(err, model.Fulfiled) {
+			return nil
 		}
-		time.Sleep(30 * time.Millisecond)
 	}
-	if err != nil {
-		log.GetSugger().Error("failed to confirm transaction ", "transaction", tx, "err", err)
+	log.GetSugger().Error("failed to confirm transaction ", "transaction", tx, "err", err)
+	s.scheduleRetry(ctx, tx, model.Processing, phaseConfirm, err)
+	return err
+}
+
+// settleRefund moves the original transaction of a fulfiled refund to Refunded or PartiallyRefunded
+func (s *service) settleRefund(ctx context.Context, tx *model.Transaction) {
+	if tx.TransactionType != model.Refund {
+		return
+	}
+	if err := s.repo.SettleRefund(ctx, tx.OriginalTransactionID); err != nil {
+		log.GetSugger().Error("failed to settle refund ", "transaction", tx.TransactionID, "original", tx.OriginalTransactionID, "err", err)
 	}
 }
 
+// tryOptions returns the options of account TCC Try by transaction type
+func tryOptions(tx *model.Transaction) []account.TryOption {
+	var opts []account.TryOption
+	if tx.TransactionType == model.Refund {
+		opts = append(opts, account.WithoutTransferLimits())
+	}
+	if tx.Fee > 0 {
+		opts = append(opts, account.WithFee(tx.FeeAccountID, tx.Fee))
+	}
+	return opts
+}
+
 func (s *service) try(ctx context.Context, tx *model.Transaction) <-chan error {
 	errChan := make(chan error)
 
 	go func() {
 		defer close(errChan)
-		if err := s.accountTCC.Try(ctx, tx.TransactionID, tx.SourceAccountID, tx.DestinationAccountID, tx.Amount); err != nil {
+		if err := s.accountTCC.Try(ctx, tx.TransactionID, tx.SourceAccountID, tx.DestinationAccountID, tx.Amount, tryOptions(tx)...); err != nil {
 			errChan <- err
 		}
 	}()
@@ -213,3 +655,18 @@ func (s *service) tryWithTimeout(ctx context.Context, tx *model.Transaction) err
 		return err
 	}
 }
+
+// ParseAmount parses amount string into inflated value, amount must be positive
+func ParseAmount(amount string) (int64, error) {
+	inflatedValue, err := utils.ParseString(amount)
+	if err != nil {
+		return 0, err
+	}
+	if inflatedValue < 0 {
+		return 0, utils.ErrNegativeValue
+	}
+	if inflatedValue == 0 {
+		return 0, ErrInvalidAmount
+	}
+	return inflatedValue, nil
+}
@@ -11,7 +11,9 @@ import (
 
 	"main/model"
 	"testing"
+	"time"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/gorm"
@@ -33,7 +35,13 @@ func (s *transactionServiceSuite) SetupTest() {
 
 	_ = s.accountDB.AutoMigrate(model.Account{})
 	_ = s.accountDB.AutoMigrate(model.FundMovement{})
+	_ = s.accountDB.AutoMigrate(model.LedgerEntry{})
+	_ = s.accountDB.AutoMigrate(model.OutboxEvent{})
 	_ = s.transactionDB.AutoMigrate(model.Transaction{})
+	_ = s.transactionDB.AutoMigrate(model.TransactionEvent{})
+	_ = s.transactionDB.AutoMigrate(model.IdempotencyKey{})
+	_ = s.transactionDB.AutoMigrate(model.Batch{})
+	_ = s.transactionDB.AutoMigrate(model.Approval{})
 
 	accouts := []model.Account{
 		{
@@ -58,12 +66,14 @@ func (s *transactionServiceSuite) TeardownTest() {
 }
 
 func (s *transactionServiceSuite) newMockService() Service {
-	return NewService(NewRepository(s.transactionDB), tcctestutils.NewMockTCC(account.NewTCCService(s.accountDB), false, false, false), account.NewRepository(s.accountDB))
+	return s.newMockServiceWithTCCTimeout(false, false, false)
 }
 
 func (s *transactionServiceSuite) newMockServiceWithTCCTimeout(try, confirm, cancel bool) Service {
-	return NewService(NewRepository(s.transactionDB), tcctestutils.NewMockTCC(account.NewTCCService(s.accountDB), try, confirm,
+	service, err := NewService(NewRepository(s.transactionDB), tcctestutils.NewMockTCC(account.NewTCCService(s.accountDB), try, confirm,
 		cancel), account.NewRepository(s.accountDB))
+	s.Require().NoError(err)
+	return service
 }
 
 func (s *transactionServiceSuite) Test_CreateTransaction_Happyflow() {
@@ -86,6 +96,69 @@ func (s *transactionServiceSuite) Test_CreateTransaction_Happyflow() {
 	assert.Equal(s.T(), inflatedValue, trx.Amount)
 }
 
+func (s *transactionServiceSuite) Test_QueryTransactionEvents_ShouldRecordStatusHistory() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "9.0",
+		}
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+
+	events, err := service.QueryTransactionEvents(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), events, 3)
+	assert.Equal(s.T(), model.TransactionStatus(0), events[0].FromStatus)
+	assert.Equal(s.T(), model.Pending, events[0].ToStatus)
+	assert.Equal(s.T(), ReasonCreated, events[0].Reason)
+	assert.Equal(s.T(), model.Pending, events[1].FromStatus)
+	assert.Equal(s.T(), model.Processing, events[1].ToStatus)
+	assert.Equal(s.T(), model.Processing, events[2].FromStatus)
+	assert.Equal(s.T(), model.Fulfiled, events[2].ToStatus)
+	assert.Equal(s.T(), ReasonConfirmed, events[2].Reason)
+	for _, event := range events {
+		assert.Equal(s.T(), string(ActorAPI), event.Actor)
+	}
+
+	_, err = service.QueryTransactionEvents(ctx, QueryTransactionRequest{TransactionID: "not-exist"})
+	assert.ErrorIs(s.T(), err, gorm.ErrRecordNotFound)
+}
+
+func (s *transactionServiceSuite) Test_TransitTransactionStatus_ShouldRejectIllegalAndStaleTransitions() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "9.0",
+		}
+		ctx     = context.Background()
+		service = s.newMockService()
+		repo    = NewRepository(s.transactionDB)
+	)
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+
+	// e.g. invalidator loaded the transaction as pending before it's fulfiled
+	err = repo.TransitTransactionStatus(ctx, trx.TransactionID, model.Pending, model.Failed, ReasonExpired)
+	assert.ErrorIs(s.T(), err, ErrStatusChanged)
+	transitionErr, ok := asTransitionError(err)
+	assert.True(s.T(), ok)
+	assert.Equal(s.T(), model.Fulfiled, transitionErr.Current)
+
+	err = repo.TransitTransactionStatus(ctx, trx.TransactionID, model.Fulfiled, model.Failed, ReasonExpired)
+	assert.ErrorIs(s.T(), err, ErrIllegalTransition)
+
+	trx, err = service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+}
+
 func (s *transactionServiceSuite) Test_CreateTransaction_InvalidAmount_ShouldReturnError() {
 	var (
 		req = CreateTransactionRequest{
@@ -131,6 +204,38 @@ func (s *transactionServiceSuite) Test_CreateTransaction_InvalidDestination_Shou
 	assert.ErrorContains(s.T(), err, "invalid reciever")
 }
 
+func (s *transactionServiceSuite) Test_CreateTransaction_CurrencyMismatch_ShouldReturnError() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 3,
+			Amount:               "1",
+		}
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	testutils.PrepareData(s.accountDB, []model.Account{
+		{
+			AccountID: 3,
+			Balance:   10000000,
+			Currency:  "USD",
+		},
+	})
+
+	_, err := service.CreateTransaction(ctx, req)
+	assert.EqualError(s.T(), account.ErrCurrencyMismatch, err.Error())
+
+	req.DestinationAccountID = 2
+	req.Currency = "USD"
+	_, err = service.CreateTransaction(ctx, req)
+	assert.EqualError(s.T(), account.ErrCurrencyMismatch, err.Error())
+
+	req.Currency = "sgd"
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.DefaultCurrency, trx.Currency)
+}
+
 func (s *transactionServiceSuite) Test_CreateTransaction_InSufficientBalance_ShouldReturnError() {
 	var (
 		req = CreateTransactionRequest{
@@ -146,6 +251,1037 @@ func (s *transactionServiceSuite) Test_CreateTransaction_InSufficientBalance_Sho
 	assert.ErrorContains(s.T(), err, "insufficient balance")
 }
 
+func (s *transactionServiceSuite) Test_CreateTransaction_IdempotencyKey_ShouldReplay() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "1",
+			IdempotencyKey:       "key-1",
+			ClientID:             "client-1",
+		}
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+
+	first, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	replay, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), first.TransactionID, replay.TransactionID)
+	assert.Equal(s.T(), model.Fulfiled, replay.TransactionStatus)
+
+	// same key with different body
+	req.Amount = "2"
+	_, err = service.CreateTransaction(ctx, req)
+	assert.EqualError(s.T(), ErrIdempotencyKeyReused, err.Error())
+
+	// key is scoped per client
+	req.ClientID = "client-2"
+	other, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.NotEqual(s.T(), first.TransactionID, other.TransactionID)
+
+	// key without client is rejected, it could collide with keys of other clients
+	req.ClientID = ""
+	_, err = service.CreateTransaction(ctx, req)
+	assert.EqualError(s.T(), ErrClientIDRequired, err.Error())
+
+	// key saved by a concurrent request is told by the unique violation
+	err = NewRepository(s.transactionDB).CreateTransactionWithIdempotencyKey(ctx, model.Transaction{TransactionID: "concurrent"},
+		model.IdempotencyKey{ClientID: "client-1", IdempotencyKey: "key-1"})
+	assert.EqualError(s.T(), ErrDuplicatedIdempotencyKey, err.Error())
+
+	s.validateAccounts(ctx, []model.Account{
+		{
+			AccountID: 1,
+			Balance:   7000000,
+		},
+	})
+}
+
+func (s *transactionServiceSuite) Test_DepositAndWithdrawal_Happyflow() {
+	var (
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	testutils.PrepareData(s.accountDB, []model.Account{
+		{
+			AccountID: 999999001,
+			Type:      model.AccountTypeClearing,
+		},
+	})
+
+	trx, err := service.CreateDeposit(ctx, FundingRequest{AccountID: 1, Amount: "5"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Deposit, trx.TransactionType)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	assert.Equal(s.T(), 999999001, trx.SourceAccountID)
+
+	trx, err = service.CreateWithdrawal(ctx, FundingRequest{AccountID: 2, Amount: "3"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Withdrawal, trx.TransactionType)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	assert.Equal(s.T(), 999999001, trx.DestinationAccountID)
+
+	_, err = service.CreateWithdrawal(ctx, FundingRequest{AccountID: 2, Amount: "100"})
+	assert.EqualError(s.T(), account.ErrInsufficientBalance, err.Error())
+
+	_, err = service.CreateDeposit(ctx, FundingRequest{AccountID: 999999001, Amount: "1"})
+	assert.EqualError(s.T(), ErrClearingAccountNotAllowed, err.Error())
+
+	_, err = service.CreateTransaction(ctx, CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 999999001, Amount: "1"})
+	assert.EqualError(s.T(), ErrClearingAccountNotAllowed, err.Error())
+
+	s.validateAccounts(ctx, []model.Account{
+		{
+			AccountID: 1,
+			Balance:   15000000,
+		},
+		{
+			AccountID: 2,
+			Balance:   7000000,
+		},
+		{
+			AccountID: 999999001,
+			Balance:   -2000000,
+		},
+	})
+}
+
+func (s *transactionServiceSuite) Test_CreateRefund_PartialThenFull() {
+	var (
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	original, err := service.CreateTransaction(ctx, CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "5"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, original.TransactionStatus)
+	// refunds are not blocked by transfer limits of the refunding account
+	assert.NoError(s.T(), s.accountDB.Model(&model.Account{}).Where("account_id = ?", 2).Update("max_single_amount", 1000000).Error)
+
+	refund, err := service.CreateRefund(ctx, RefundRequest{TransactionID: original.TransactionID, Amount: "2"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Refund, refund.TransactionType)
+	assert.Equal(s.T(), model.Fulfiled, refund.TransactionStatus)
+	assert.Equal(s.T(), original.TransactionID, refund.OriginalTransactionID)
+	assert.Equal(s.T(), 2, refund.SourceAccountID)
+	assert.Equal(s.T(), 1, refund.DestinationAccountID)
+
+	trx, _ := service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: original.TransactionID})
+	assert.Equal(s.T(), model.PartiallyRefunded, trx.TransactionStatus)
+
+	_, err = service.CreateRefund(ctx, RefundRequest{TransactionID: original.TransactionID, Amount: "4"})
+	assert.EqualError(s.T(), ErrRefundExceedsAmount, err.Error())
+
+	// refund the remaining amount
+	refund, err = service.CreateRefund(ctx, RefundRequest{TransactionID: original.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(3000000), refund.Amount)
+
+	trx, _ = service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: original.TransactionID})
+	assert.Equal(s.T(), model.Refunded, trx.TransactionStatus)
+
+	_, err = service.CreateRefund(ctx, RefundRequest{TransactionID: original.TransactionID})
+	assert.EqualError(s.T(), ErrTransactionNotRefundable, err.Error())
+	// refund can not be refunded
+	_, err = service.CreateRefund(ctx, RefundRequest{TransactionID: refund.TransactionID})
+	assert.EqualError(s.T(), ErrTransactionNotRefundable, err.Error())
+
+	s.validateAccounts(ctx, []model.Account{
+		{
+			AccountID: 1,
+			Balance:   10000000,
+		},
+		{
+			AccountID: 2,
+			Balance:   10000000,
+		},
+	})
+}
+
+func (s *transactionServiceSuite) Test_CreateBatch_Happyflow() {
+	var (
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	testutils.PrepareData(s.accountDB, []model.Account{{AccountID: 3}})
+
+	batch, err := service.CreateBatch(ctx, CreateBatchRequest{
+		SourceAccountID: 1,
+		Transfers: []BatchTransferRequest{
+			{DestinationAccountID: 2, Amount: "2"},
+			{DestinationAccountID: 3, Amount: "3"},
+		},
+	})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, batch.BatchStatus)
+	assert.Equal(s.T(), int64(5000000), batch.TotalAmount)
+	assert.Len(s.T(), batch.Transactions, 2)
+	for _, trx := range batch.Transactions {
+		assert.Equal(s.T(), batch.BatchID, trx.BatchID)
+		assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	}
+
+	s.validateAccounts(ctx, []model.Account{
+		{
+			AccountID: 1,
+			Balance:   5000000,
+		},
+		{
+			AccountID: 2,
+			Balance:   12000000,
+		},
+		{
+			AccountID: 3,
+			Balance:   3000000,
+		},
+	})
+}
+
+func (s *transactionServiceSuite) Test_CreateBatch_InsufficientBalance_ShouldCancelAll() {
+	var (
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	testutils.PrepareData(s.accountDB, []model.Account{{AccountID: 3}})
+
+	batch, err := service.CreateBatch(ctx, CreateBatchRequest{
+		SourceAccountID: 1,
+		Transfers: []BatchTransferRequest{
+			{DestinationAccountID: 2, Amount: "6"},
+			{DestinationAccountID: 3, Amount: "6"},
+		},
+	})
+	assert.EqualError(s.T(), account.ErrInsufficientBalance, err.Error())
+	assert.Equal(s.T(), model.Failed, batch.BatchStatus)
+	for _, trx := range batch.Transactions {
+		assert.Equal(s.T(), model.Failed, trx.TransactionStatus)
+	}
+	// a canceled batch can not be moved forward by a late run
+	repo := NewRepository(s.transactionDB)
+	assert.ErrorIs(s.T(), repo.UpdateBatchStatus(ctx, batch.BatchID, model.Pending, model.Processing), ErrBatchStatusChanged)
+	batch, err = service.QueryBatch(ctx, QueryBatchRequest{BatchID: batch.BatchID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Failed, batch.BatchStatus)
+
+	_, err = service.CreateBatch(ctx, CreateBatchRequest{SourceAccountID: 1})
+	assert.EqualError(s.T(), ErrEmptyBatch, err.Error())
+
+	// fund held by the first transfer is released
+	accRepo := account.NewRepository(s.accountDB)
+	acc, err := accRepo.GetAccountByID(ctx, 1)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(10000000), acc.Balance)
+	assert.Equal(s.T(), int64(0), acc.OutBalance)
+	s.validateAccounts(ctx, []model.Account{
+		{
+			AccountID: 2,
+			Balance:   10000000,
+		},
+		{
+			AccountID: 3,
+			Balance:   0,
+		},
+	})
+}
+
+func (s *transactionServiceSuite) Test_ScheduledTransaction_ExecuteAndCancel() {
+	var (
+		ctx       = context.Background()
+		service   = s.newMockService()
+		executeAt = time.Now().Add(time.Hour)
+		req       = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "1",
+			ExecuteAt:            &executeAt,
+			RequestedBy:          "alice",
+		}
+	)
+
+	scheduled, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Scheduled, scheduled.TransactionStatus)
+	toCancel, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+
+	// not due yet
+	_, err = service.ExecuteScheduledTransaction(ctx, QueryTransactionRequest{TransactionID: scheduled.TransactionID})
+	assert.EqualError(s.T(), ErrTransactionNotScheduled, err.Error())
+
+	// only the sender can cancel it
+	_, err = service.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: toCancel.TransactionID})
+	assert.EqualError(s.T(), ErrUserRequired, err.Error())
+	_, err = service.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: toCancel.TransactionID, UserID: "bob"})
+	assert.EqualError(s.T(), ErrNotTransactionSender, err.Error())
+
+	trx, err := service.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: toCancel.TransactionID, UserID: "alice"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Revoked, trx.TransactionStatus)
+
+	assert.NoError(s.T(), s.transactionDB.Model(&model.Transaction{}).Where("execute_at IS NOT NULL").Update("execute_at", time.Now().Add(-time.Second)).Error)
+	due, err := NewRepository(s.transactionDB).QueryDueScheduledTransactions(ctx, time.Now(), MaxScheduledTransactionsPerRun)
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), due, 1)
+
+	trx, err = service.ExecuteScheduledTransaction(ctx, QueryTransactionRequest{TransactionID: scheduled.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+
+	// confirmed transaction can not be canceled
+	_, err = service.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: scheduled.TransactionID, UserID: "alice"})
+	assert.EqualError(s.T(), ErrTransactionConfirmed, err.Error())
+
+	// nobody can cancel a transaction created without user
+	anonymous := req
+	anonymous.RequestedBy = ""
+	withoutCreator, err := service.CreateTransaction(ctx, anonymous)
+	assert.NoError(s.T(), err)
+	_, err = service.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: withoutCreator.TransactionID, UserID: "alice"})
+	assert.EqualError(s.T(), ErrTransactionWithoutCreator, err.Error())
+
+	past := time.Now().Add(-time.Minute)
+	req.ExecuteAt = &past
+	_, err = service.CreateTransaction(ctx, req)
+	assert.EqualError(s.T(), ErrInvalidExecuteAt, err.Error())
+
+	s.validateAccounts(ctx, []model.Account{
+		{
+			AccountID: 1,
+			Balance:   9000000,
+		},
+		{
+			AccountID: 2,
+			Balance:   11000000,
+		},
+	})
+}
+
+func (s *transactionServiceSuite) Test_CancelPendingTransaction_ShouldRevokeAndReleaseFund() {
+	var (
+		ctx     = context.Background()
+		svc     = s.newMockService()
+		repo    = NewRepository(s.transactionDB)
+		tcc     = account.NewTCCService(s.accountDB)
+		accRepo = account.NewRepository(s.accountDB)
+		pending = func() model.Transaction {
+			trx := model.Transaction{
+				TransactionID:        utils.GenerateTransactionID(),
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               3000000,
+				Currency:             "SGD",
+				TransactionStatus:    model.Pending,
+				TransactionType:      model.Transfer,
+				CreatedBy:            "alice",
+			}
+			assert.NoError(s.T(), repo.CreateTransaction(ctx, trx))
+			return trx
+		}
+	)
+
+	// canceled after try, held fund is released
+	tried := pending()
+	assert.NoError(s.T(), tcc.Try(ctx, tried.TransactionID, 1, 2, tried.Amount))
+	trx, err := svc.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: tried.TransactionID, UserID: "alice"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Revoked, trx.TransactionStatus)
+	assert.Nil(s.T(), trx.NextRetryAt)
+	source, _ := accRepo.GetAccountByID(ctx, 1)
+	assert.Equal(s.T(), int64(0), source.OutBalance)
+
+	// canceled before try, a concurrent processing can not move fund any more
+	notTried := pending()
+	trx, err = svc.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: notTried.TransactionID, UserID: "alice"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Revoked, trx.TransactionStatus)
+	trxChan, err := svc.(*service).processTransaction(ctx, &notTried)
+	assert.ErrorIs(s.T(), err, account.ErrRollbacked)
+	trx = <-trxChan
+	assert.Equal(s.T(), model.Revoked, trx.TransactionStatus)
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000},
+		{AccountID: 2, Balance: 10000000},
+	})
+
+	_, err = svc.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: notTried.TransactionID, UserID: "alice"})
+	assert.ErrorIs(s.T(), err, ErrTransactionNotCancelable)
+}
+
+func (s *transactionServiceSuite) Test_InvalidateTransaction_ShouldNeverCancelProcessing() {
+	var (
+		ctx     = context.Background()
+		repo    = NewRepository(s.transactionDB)
+		tcc     = account.NewTCCService(s.accountDB)
+		accRepo = account.NewRepository(s.accountDB)
+		tried   = func(status model.TransactionStatus) model.Transaction {
+			trx := model.Transaction{
+				TransactionID:        utils.GenerateTransactionID(),
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               3000000,
+				Currency:             "SGD",
+				TransactionStatus:    model.Pending,
+				TransactionType:      model.Transfer,
+			}
+			assert.NoError(s.T(), repo.CreateTransaction(ctx, trx))
+			assert.NoError(s.T(), tcc.Try(ctx, trx.TransactionID, 1, 2, trx.Amount))
+			if status == model.Processing {
+				assert.NoError(s.T(), repo.TransitTransactionStatus(ctx, trx.TransactionID, model.Pending, model.Processing, ReasonTried))
+			}
+			return trx
+		}
+	)
+	assert.ErrorIs(s.T(), repo.TransitTransactionStatus(ctx, tried(model.Processing).TransactionID, model.Processing, model.Failed, ReasonExpired), ErrIllegalTransition)
+
+	// confirm keeps failing, it's retried instead of canceled
+	processing := tried(model.Processing)
+	trx, err := s.newMockServiceWithTCCTimeout(false, true, false).InvalidateTransaction(ctx, QueryTransactionRequest{TransactionID: processing.TransactionID})
+	assert.Error(s.T(), err)
+	assert.Equal(s.T(), model.Processing, trx.TransactionStatus)
+	trx, _ = repo.GetTransactionByID(ctx, processing.TransactionID)
+	assert.Equal(s.T(), model.Processing, trx.TransactionStatus)
+	assert.NotNil(s.T(), trx.NextRetryAt)
+
+	// expired processing transaction is confirmed
+	service := s.newMockService()
+	trx, err = service.InvalidateTransaction(ctx, QueryTransactionRequest{TransactionID: processing.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+
+	// expired pending transaction is canceled
+	pending := tried(model.Pending)
+	trx, err = service.InvalidateTransaction(ctx, QueryTransactionRequest{TransactionID: pending.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Failed, trx.TransactionStatus)
+
+	// only the fund of the first processing transaction is still held
+	source, _ := accRepo.GetAccountByID(ctx, 1)
+	assert.Equal(s.T(), int64(3000000), source.OutBalance)
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 3000000},
+		{AccountID: 2, Balance: 10000000 + 3000000},
+	})
+}
+
+func (s *transactionServiceSuite) Test_ListTransactions_FiltersAndCursor() {
+	var (
+		ctx     = context.Background()
+		service = s.newMockService()
+		created []string
+	)
+	for _, amount := range []string{"1", "2", "3", "4"} {
+		trx, err := service.CreateTransaction(ctx, CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: amount})
+		assert.NoError(s.T(), err)
+		created = append(created, trx.TransactionID)
+	}
+	_, err := service.CreateTransaction(ctx, CreateTransactionRequest{SourceAccountID: 2, DestinationAccountID: 1, Amount: "100"})
+	assert.EqualError(s.T(), account.ErrInsufficientBalance, err.Error())
+
+	// page through transactions from account 1, latest first
+	var listed []string
+	req := ListTransactionsRequest{SourceAccountID: 1, Limit: 3}
+	for {
+		transactions, cursor, err := service.ListTransactions(ctx, req)
+		assert.NoError(s.T(), err)
+		for _, trx := range transactions {
+			listed = append(listed, trx.TransactionID)
+		}
+		if cursor == "" {
+			break
+		}
+		req.Cursor = cursor
+	}
+	assert.Equal(s.T(), []string{created[3], created[2], created[1], created[0]}, listed)
+
+	transactions, _, err := service.ListTransactions(ctx, ListTransactionsRequest{AccountID: 1, Status: []int{int(model.Failed)}})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), transactions, 1)
+	assert.Equal(s.T(), 2, transactions[0].SourceAccountID)
+
+	transactions, _, err = service.ListTransactions(ctx, ListTransactionsRequest{MinAmount: "2", MaxAmount: "3"})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), transactions, 2)
+
+	_, _, err = service.ListTransactions(ctx, ListTransactionsRequest{MinAmount: "3", MaxAmount: "2"})
+	assert.EqualError(s.T(), errInvalidParams, err.Error())
+	_, _, err = service.ListTransactions(ctx, ListTransactionsRequest{Cursor: "invalid"})
+	assert.EqualError(s.T(), utils.ErrInvalidCursor, err.Error())
+}
+
+func (s *transactionServiceSuite) Test_CreateTransaction_Async_WaitUntilFulfiled() {
+	var (
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	trx, err := service.CreateTransaction(ctx, CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "1", Async: true})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Pending, trx.TransactionStatus)
+
+	trx, err = service.WaitTransaction(ctx, WaitTransactionRequest{TransactionID: trx.TransactionID, Timeout: 5})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+
+	s.validateAccounts(ctx, []model.Account{
+		{
+			AccountID: 1,
+			Balance:   9000000,
+		},
+		{
+			AccountID: 2,
+			Balance:   11000000,
+		},
+	})
+}
+
+func (s *transactionServiceSuite) Test_CreateTransaction_Async_QueueFull_ShouldNotBindIdempotencyKey() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "1",
+			Async:                true,
+			IdempotencyKey:       "key-1",
+			ClientID:             "client-1",
+		}
+		ctx     = context.Background()
+		service = s.newMockService().(*service)
+	)
+	// take all slots of the queue
+	reserved := 0
+	for service.asyncPool.reserve() {
+		reserved++
+	}
+
+	_, err := service.CreateTransaction(ctx, req)
+	assert.EqualError(s.T(), err, ErrTooManyPendingTransactions.Error())
+	var count int64
+	s.transactionDB.Model(&model.Transaction{}).Count(&count)
+	assert.Equal(s.T(), int64(0), count)
+
+	// retry with the same key is processed once the queue has room
+	for ; reserved > 0; reserved-- {
+		service.asyncPool.release()
+	}
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	trx, err = service.WaitTransaction(ctx, WaitTransactionRequest{TransactionID: trx.TransactionID, Timeout: 5})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+}
+
+func (s *transactionServiceSuite) Test_ConfirmExhausted_ShouldGoToManualHandling_AndResolve() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "9.0",
+		}
+		ctx     = context.Background()
+		service = s.newMockServiceWithTCCTimeout(false, true, false)
+	)
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Processing, trx.TransactionStatus)
+	assert.Equal(s.T(), 1, trx.Attempts)
+	assert.NotNil(s.T(), trx.NextRetryAt)
+	assert.Equal(s.T(), context.DeadlineExceeded.Error(), trx.LastError)
+
+	// not due yet
+	assert.NoError(s.T(), service.RetryDueTransactions(ctx, time.Now().Add(-time.Second)))
+	trx, _ = service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.Equal(s.T(), 1, trx.Attempts)
+
+	// max_retries is 2 in test
+	assert.NoError(s.T(), service.RetryDueTransactions(ctx, time.Now().Add(time.Hour)))
+	trx, _ = service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.Equal(s.T(), model.ManualHandling, trx.TransactionStatus)
+	assert.Equal(s.T(), 2, trx.Attempts)
+	assert.Nil(s.T(), trx.NextRetryAt)
+
+	transactions, _, err := service.ListManualTransactions(ctx, ListTransactionsRequest{})
+	assert.NoError(s.T(), err)
+	assert.Len(s.T(), transactions, 1)
+	assert.Equal(s.T(), trx.TransactionID, transactions[0].TransactionID)
+
+	_, err = service.ResolveTransaction(ctx, ResolveTransactionRequest{TransactionID: trx.TransactionID, Action: ResolveClose})
+	assert.ErrorIs(s.T(), err, ErrResolveNoteRequired)
+	_, err = service.ResolveTransaction(ctx, ResolveTransactionRequest{TransactionID: trx.TransactionID, Action: "refund"})
+	assert.ErrorIs(s.T(), err, ErrInvalidResolveAction)
+
+	// confirm works again
+	service = s.newMockService()
+	trx, err = service.ResolveTransaction(ctx, ResolveTransactionRequest{TransactionID: trx.TransactionID, Action: ResolveConfirm})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 9000000},
+		{AccountID: 2, Balance: 10000000 + 9000000},
+	})
+
+	_, err = service.ResolveTransaction(ctx, ResolveTransactionRequest{TransactionID: trx.TransactionID, Action: ResolveCancel})
+	assert.ErrorIs(s.T(), err, ErrTransactionNotInManualHandling)
+
+	events, err := service.QueryTransactionEvents(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	last := events[len(events)-1]
+	assert.Equal(s.T(), model.ManualHandling, last.FromStatus)
+	assert.Equal(s.T(), string(ActorOperator), last.Actor)
+}
+
+func (s *transactionServiceSuite) Test_RetryBackoff_ShouldDoubleUntilMax() {
+	assert.Equal(s.T(), defaultRetryBase, retryBackoff(phaseConfirm, 1))
+	assert.Equal(s.T(), 4*defaultRetryBase, retryBackoff(phaseConfirm, 3))
+	assert.Equal(s.T(), defaultRetryLimit, retryBackoff(phaseCancel, 30))
+}
+
+func (s *transactionServiceSuite) Test_ConfirmFailed_ShouldBeConfirmedByRetryWorker() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "9.0",
+		}
+		ctx = context.Background()
+	)
+	trx, err := s.newMockServiceWithTCCTimeout(false, true, false).CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Processing, trx.TransactionStatus)
+
+	// a new process picks up the retry
+	service := s.newMockService()
+	assert.NoError(s.T(), service.RetryDueTransactions(ctx, time.Now().Add(time.Hour)))
+	trx, err = service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	assert.Nil(s.T(), trx.NextRetryAt)
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 9000000},
+		{AccountID: 2, Balance: 10000000 + 9000000},
+	})
+
+	events, err := service.QueryTransactionEvents(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), string(ActorRetry), events[len(events)-1].Actor)
+}
+
+func (s *transactionServiceSuite) Test_AuthorizeCaptureAndVoid() {
+	var (
+		capture = false
+		req     = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "3.0",
+			Capture:              &capture,
+		}
+		ctx     = context.Background()
+		service = s.newMockService()
+		accRepo = account.NewRepository(s.accountDB)
+	)
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Authorized, trx.TransactionStatus)
+	assert.True(s.T(), trx.ManualCapture)
+	source, _ := accRepo.GetAccountByID(ctx, 1)
+	assert.Equal(s.T(), int64(3000000), source.OutBalance)
+
+	trx, err = service.ConfirmTransaction(ctx, ConfirmTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 3000000},
+		{AccountID: 2, Balance: 10000000 + 3000000},
+	})
+	_, err = service.VoidTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.ErrorIs(s.T(), err, ErrTransactionNotAuthorized)
+
+	// void releases held fund
+	trx, err = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	trx, err = service.VoidTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Voided, trx.TransactionStatus)
+	assert.Nil(s.T(), trx.NextRetryAt)
+	source, _ = accRepo.GetAccountByID(ctx, 1)
+	assert.Equal(s.T(), int64(0), source.OutBalance)
+	_, err = service.ConfirmTransaction(ctx, ConfirmTransactionRequest{TransactionID: trx.TransactionID})
+	assert.ErrorIs(s.T(), err, ErrTransactionNotAuthorized)
+
+	// expired authorization is voided by invalidator
+	trx, err = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.NoError(s.T(), service.ExpireAuthorizations(ctx, time.Now()))
+	trx, _ = service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.Equal(s.T(), model.Authorized, trx.TransactionStatus)
+	assert.NoError(s.T(), service.ExpireAuthorizations(ctx, time.Now().Add(time.Minute*DefaultAuthorizationExpirationMinutes+time.Minute)))
+	trx, _ = service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.Equal(s.T(), model.Voided, trx.TransactionStatus)
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 3000000},
+		{AccountID: 2, Balance: 10000000 + 3000000},
+	})
+	source, _ = accRepo.GetAccountByID(ctx, 1)
+	assert.Equal(s.T(), int64(0), source.OutBalance)
+}
+
+func (s *transactionServiceSuite) Test_FeeRule_Calculate() {
+	tiered := FeeRule{Type: FeeTiered, Tiers: []FeeTier{
+		{UpTo: "100", Flat: "1"},
+		{UpTo: "1000", Flat: "0.5", Percentage: "1"},
+		{Percentage: "0.1"},
+	}}
+	for _, c := range []struct {
+		rule   FeeRule
+		amount int64
+		fee    int64
+	}{
+		{FeeRule{}, 1000000, 0},
+		{FeeRule{Type: FeeFlat, Flat: "0.5"}, 1000000, 500000},
+		{FeeRule{Type: FeePercentage, Percentage: "0.5"}, 1000000, 5000},
+		// rounded half up to the smallest unit
+		{FeeRule{Type: FeePercentage, Percentage: "0.5"}, 100, 1},
+		{FeeRule{Type: FeePercentage, Percentage: "0.5"}, 99, 0},
+		{tiered, 100000000, 1000000},
+		{tiered, 200000000, 500000 + 2000000},
+		{tiered, 2000000000, 2000000},
+	} {
+		fee, err := c.rule.Calculate(c.amount)
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), c.fee, fee, "rule %v amount %d", c.rule, c.amount)
+	}
+	_, err := FeeRule{Type: "unknown"}.Calculate(100)
+	assert.ErrorIs(s.T(), err, ErrInvalidFeeRule)
+	_, err = FeeRule{Type: FeeFlat, Flat: "-1"}.Calculate(100)
+	assert.ErrorIs(s.T(), err, ErrInvalidFeeRule)
+}
+
+func (s *transactionServiceSuite) Test_CreateTransaction_WithFee_ShouldCreditFeeAccount() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "2.0",
+		}
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	viper.Set(config.ConfigKeyFeeAccounts, map[string]interface{}{model.DefaultCurrency: 999})
+	viper.Set("fees", map[string]interface{}{
+		"default":  map[string]interface{}{"type": "percentage", "percentage": "1"},
+		"accounts": map[string]interface{}{"2": map[string]interface{}{"type": "flat", "flat": "0.5"}},
+	})
+	defer func() {
+		viper.Set(config.ConfigKeyFeeAccounts, nil)
+		viper.Set("fees", nil)
+	}()
+	testutils.PrepareData(s.accountDB, []model.Account{{AccountID: 999}})
+
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	assert.Equal(s.T(), int64(20000), trx.Fee)
+	assert.Equal(s.T(), 999, trx.FeeAccountID)
+
+	// rule of source account overrides the default one
+	req.SourceAccountID, req.DestinationAccountID = 2, 1
+	trx, err = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(500000), trx.Fee)
+
+	// fee is paid on top of the amount
+	req.Amount = "10.0"
+	_, err = service.CreateTransaction(ctx, req)
+	assert.ErrorIs(s.T(), err, account.ErrInsufficientBalance)
+
+	// transfers to fee account are free
+	req.DestinationAccountID = 999
+	req.Amount = "1.0"
+	trx, err = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), int64(0), trx.Fee)
+
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 2000000 - 20000 + 2000000},
+		{AccountID: 2, Balance: 10000000 + 2000000 - 2000000 - 500000 - 1000000},
+		{AccountID: 999, Balance: 20000 + 500000 + 1000000},
+	})
+}
+
+func (s *transactionServiceSuite) Test_RelayOutbox_ShouldApplyFundMovementStage() {
+	var (
+		ctx       = context.Background()
+		service   = s.newMockService().(*service)
+		repo      = NewRepository(s.transactionDB)
+		tcc       = account.NewTCCService(s.accountDB)
+		confirmed = model.Transaction{TransactionID: "confirmed", SourceAccountID: 1, DestinationAccountID: 2, Amount: 1000000, TransactionStatus: model.Pending}
+		canceled  = model.Transaction{TransactionID: "canceled", SourceAccountID: 1, DestinationAccountID: 2, Amount: 1000000, TransactionStatus: model.Pending}
+		tried     = model.Transaction{TransactionID: "tried", SourceAccountID: 1, DestinationAccountID: 2, Amount: 1000000, TransactionStatus: model.Pending}
+		manual    = model.Transaction{TransactionID: "manual", SourceAccountID: 1, DestinationAccountID: 2, Amount: 1000000, TransactionStatus: model.Pending}
+	)
+	for _, trx := range []model.Transaction{confirmed, canceled, tried, manual} {
+		assert.NoError(s.T(), repo.CreateTransaction(ctx, trx))
+		assert.NoError(s.T(), tcc.Try(ctx, trx.TransactionID, trx.SourceAccountID, trx.DestinationAccountID, trx.Amount))
+	}
+	// fund movements are confirmed and canceled, but the process dies before updating transactions
+	assert.NoError(s.T(), repo.TransitTransactionStatus(ctx, confirmed.TransactionID, model.Pending, model.Processing, ReasonTried))
+	assert.NoError(s.T(), tcc.Confirm(ctx, confirmed.TransactionID))
+	assert.NoError(s.T(), tcc.Cancel(ctx, canceled.TransactionID))
+	// manual handling transaction is left to the operator
+	assert.NoError(s.T(), repo.TransitTransactionStatus(ctx, manual.TransactionID, model.Pending, model.Processing, ReasonTried))
+	assert.NoError(s.T(), repo.MarkManualHandling(ctx, manual.TransactionID, model.Processing, "confirm timeout"))
+	assert.NoError(s.T(), tcc.Confirm(ctx, manual.TransactionID))
+
+	relayCtx := WithActor(ctx, ActorOutboxRelay)
+	assert.NoError(s.T(), service.RelayOutbox(relayCtx))
+	// relayed events are not applied again
+	assert.NoError(s.T(), service.RelayOutbox(relayCtx))
+
+	for id, status := range map[string]model.TransactionStatus{
+		confirmed.TransactionID: model.Fulfiled,
+		canceled.TransactionID:  model.Failed,
+		tried.TransactionID:     model.Pending,
+		manual.TransactionID:    model.ManualHandling,
+	} {
+		trx, err := service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: id})
+		assert.NoError(s.T(), err)
+		assert.Equal(s.T(), status, trx.TransactionStatus, id)
+		events, err := service.QueryTransactionEvents(ctx, QueryTransactionRequest{TransactionID: id})
+		assert.NoError(s.T(), err)
+		if status != model.Pending && status != model.ManualHandling {
+			assert.Equal(s.T(), string(ActorOutboxRelay), events[len(events)-1].Actor)
+		}
+	}
+	pending, err := account.NewRepository(s.accountDB).QueryOutboxEvents(ctx, 10)
+	assert.NoError(s.T(), err)
+	assert.Empty(s.T(), pending)
+
+	// the normal flow finishing after the relay is not failed
+	confirmed.TransactionStatus = model.Processing
+	assert.NoError(s.T(), service.retryConfirm(ctx, &confirmed))
+	assert.NoError(s.T(), service.retryCancel(ctx, &canceled, ReasonTryTimeout))
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 1000000 - 1000000},
+		{AccountID: 2, Balance: 10000000 + 1000000 + 1000000},
+	})
+}
+
+func (s *transactionServiceSuite) Test_RiskRules_ShouldAllowDenyOrReview() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "1.0",
+			RequestedBy:          "alice",
+		}
+		ctx  = context.Background()
+		repo = NewRepository(s.transactionDB)
+	)
+	// rules are built once by NewService
+	viper.Set(config.ConfigKeyRiskRules, []map[string]interface{}{
+		{"type": RiskRuleNewDestination, "min_amount": "1"},
+		{"type": RiskRuleVelocity, "window_minutes": 60, "max_count": 2},
+	})
+	defer viper.Set(config.ConfigKeyRiskRules, nil)
+	service := s.newMockService()
+
+	// first transfer to account 2 is reviewed, the next one is allowed
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.AwaitingApproval, trx.TransactionStatus)
+	trx, err = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+
+	// the third transfer in an hour is denied and not saved
+	_, err = service.CreateTransaction(ctx, req)
+	assert.ErrorIs(s.T(), err, ErrRiskDenied)
+	var denied *RiskDeniedError
+	assert.ErrorAs(s.T(), err, &denied)
+	assert.Equal(s.T(), "more than 2 transfers in 1h0m0s", denied.Reason)
+	stats, err := repo.QueryTransferStats(ctx, TransferStatsQuery{SourceAccountID: 1})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), TransferStats{Count: 2, Total: 2000000}, stats)
+
+	viper.Set(config.ConfigKeyRiskRules, []map[string]interface{}{
+		{"type": RiskRuleAmountOutlier, "lookback_days": 30, "multiplier": 2, "min_samples": 2},
+		{"type": RiskRuleBlocklist, "accounts": []int{3}},
+	})
+	service = s.newMockService()
+	req.Amount = "2.0"
+	trx, err = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	req.Amount = "5.0"
+	trx, err = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.AwaitingApproval, trx.TransactionStatus)
+
+	viper.Set(config.ConfigKeyRiskRules, []map[string]interface{}{{"type": RiskRuleBlocklist, "accounts": []int{2}}})
+	service = s.newMockService()
+	req.SourceAccountID, req.DestinationAccountID = 2, 1
+	_, err = service.CreateTransaction(ctx, req)
+	assert.ErrorIs(s.T(), err, ErrRiskDenied)
+
+	// batch legs and fundings are checked too
+	_, err = service.CreateBatch(ctx, CreateBatchRequest{
+		SourceAccountID: 1,
+		Transfers:       []BatchTransferRequest{{DestinationAccountID: 2, Amount: "1.0"}},
+	})
+	assert.ErrorIs(s.T(), err, ErrRiskDenied)
+	testutils.PrepareData(s.accountDB, []model.Account{{AccountID: 999999001, Type: model.AccountTypeClearing}})
+	_, err = service.CreateWithdrawal(ctx, FundingRequest{AccountID: 2, Amount: "1.0"})
+	assert.ErrorIs(s.T(), err, ErrRiskDenied)
+	trx, err = service.CreateDeposit(ctx, FundingRequest{AccountID: 1, Amount: "1.0"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+
+	// invalid rules fail the boot
+	viper.Set(config.ConfigKeyRiskRules, []map[string]interface{}{{"type": "unknown"}})
+	_, err = NewService(NewRepository(s.transactionDB), account.NewTCCService(s.accountDB), account.NewRepository(s.accountDB))
+	assert.Error(s.T(), err)
+}
+
+func (s *transactionServiceSuite) Test_ApprovalRequired_ShouldWaitForSecondUser() {
+	var (
+		req = CreateTransactionRequest{
+			SourceAccountID:      1,
+			DestinationAccountID: 2,
+			Amount:               "6.0",
+			RequestedBy:          "alice",
+		}
+		ctx     = context.Background()
+		service = s.newMockService()
+	)
+	viper.Set(config.ConfigKeyApprovalThresholds, map[string]interface{}{model.DefaultCurrency: "5"})
+	defer viper.Set(config.ConfigKeyApprovalThresholds, nil)
+	viper.Set(config.ConfigKeyApprovers, []string{"alice", "bob"})
+	defer viper.Set(config.ConfigKeyApprovers, nil)
+
+	// maker is required, otherwise anyone could approve it
+	_, err := service.CreateTransaction(ctx, CreateTransactionRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: "6.0"})
+	assert.ErrorIs(s.T(), err, ErrRequesterRequired)
+	assert.ErrorIs(s.T(), checkApprover("bob", ""), ErrRequesterRequired)
+
+	trx, err := service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.AwaitingApproval, trx.TransactionStatus)
+	s.validateAccounts(ctx, []model.Account{{AccountID: 1, Balance: 10000000}})
+
+	approval := ApprovalRequest{TransactionID: trx.TransactionID}
+	_, err = service.ApproveTransaction(ctx, approval)
+	assert.ErrorIs(s.T(), err, ErrApproverRequired)
+	approval.Approver = "alice"
+	_, err = service.ApproveTransaction(ctx, approval)
+	assert.ErrorIs(s.T(), err, ErrSelfApproval)
+	approval.Approver = "carol"
+	_, err = service.ApproveTransaction(ctx, approval)
+	assert.ErrorIs(s.T(), err, ErrApproverNotAllowed)
+	// nobody can approve if approvers are not configured
+	viper.Set(config.ConfigKeyApprovers, nil)
+	approval.Approver = "bob"
+	_, err = service.ApproveTransaction(ctx, approval)
+	assert.ErrorIs(s.T(), err, ErrApproversNotConfigured)
+	viper.Set(config.ConfigKeyApprovers, []string{"alice", "bob"})
+
+	trx, err = service.ApproveTransaction(ctx, approval)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+	assert.Equal(s.T(), model.ApprovalApproved, trx.Approval.Status)
+	assert.Equal(s.T(), "alice", trx.Approval.RequestedBy)
+	assert.Equal(s.T(), "bob", trx.Approval.DecidedBy)
+	assert.NotNil(s.T(), trx.Approval.DecidedAt)
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 6000000},
+		{AccountID: 2, Balance: 10000000 + 6000000},
+	})
+	_, err = service.RejectTransaction(ctx, approval)
+	assert.ErrorIs(s.T(), err, ErrTransactionNotAwaitingApproval)
+	events, err := service.QueryTransactionEvents(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.AwaitingApproval, events[1].FromStatus)
+	assert.Equal(s.T(), string(ActorApprover), events[1].Actor)
+
+	// rejected, canceled by sender, and expired transfers move no fund
+	trx, _ = service.CreateTransaction(ctx, req)
+	trx, err = service.RejectTransaction(ctx, ApprovalRequest{TransactionID: trx.TransactionID, Approver: "bob", Note: "unknown payee"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Rejected, trx.TransactionStatus)
+	assert.Equal(s.T(), "unknown payee", trx.Approval.Note)
+
+	trx, _ = service.CreateTransaction(ctx, req)
+	trx, err = service.CancelTransaction(ctx, CancelTransactionRequest{TransactionID: trx.TransactionID, UserID: "alice"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Revoked, trx.TransactionStatus)
+	assert.Equal(s.T(), model.ApprovalCanceled, trx.Approval.Status)
+
+	trx, _ = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), service.ExpireApprovals(ctx, time.Now()))
+	assert.NoError(s.T(), service.ExpireApprovals(ctx, time.Now().Add(time.Minute*DefaultApprovalExpirationMinutes+time.Minute)))
+	trx, _ = service.QueryTransaction(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.Equal(s.T(), model.Rejected, trx.TransactionStatus)
+	expired, err := service.QueryApproval(ctx, QueryTransactionRequest{TransactionID: trx.TransactionID})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.ApprovalExpired, expired.Status)
+
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 6000000},
+		{AccountID: 2, Balance: 10000000 + 6000000},
+	})
+
+	// transfers up to the threshold do not wait
+	req.Amount = "3.0"
+	trx, err = service.CreateTransaction(ctx, req)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, trx.TransactionStatus)
+
+	// batch above the threshold waits for approval as a whole
+	batchReq := CreateBatchRequest{
+		SourceAccountID: 2,
+		Transfers:       []BatchTransferRequest{{DestinationAccountID: 1, Amount: "3.0"}, {DestinationAccountID: 1, Amount: "3.0"}},
+	}
+	_, err = service.CreateBatch(ctx, batchReq)
+	assert.ErrorIs(s.T(), err, ErrRequesterRequired)
+	batchReq.RequestedBy = "alice"
+	batch, err := service.CreateBatch(ctx, batchReq)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.AwaitingApproval, batch.BatchStatus)
+	assert.Equal(s.T(), batch.BatchID, batch.Approval.BatchID)
+	for _, leg := range batch.Transactions {
+		assert.Equal(s.T(), model.AwaitingApproval, leg.TransactionStatus)
+	}
+	batchApproval := BatchApprovalRequest{BatchID: batch.BatchID, Approver: "alice"}
+	_, err = service.ApproveBatch(ctx, batchApproval)
+	assert.ErrorIs(s.T(), err, ErrSelfApproval)
+	batchApproval.Approver = "bob"
+	batch, err = service.ApproveBatch(ctx, batchApproval)
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Fulfiled, batch.BatchStatus)
+	assert.Equal(s.T(), model.ApprovalApproved, batch.Approval.Status)
+	for _, leg := range batch.Transactions {
+		assert.Equal(s.T(), model.Fulfiled, leg.TransactionStatus)
+	}
+	_, err = service.RejectBatch(ctx, batchApproval)
+	assert.ErrorIs(s.T(), err, ErrTransactionNotAwaitingApproval)
+
+	// rejected or expired batch moves no fund
+	batch, _ = service.CreateBatch(ctx, batchReq)
+	batch, err = service.RejectBatch(ctx, BatchApprovalRequest{BatchID: batch.BatchID, Approver: "bob"})
+	assert.NoError(s.T(), err)
+	assert.Equal(s.T(), model.Rejected, batch.BatchStatus)
+	batch, _ = service.CreateBatch(ctx, batchReq)
+	assert.NoError(s.T(), service.ExpireApprovals(ctx, time.Now().Add(time.Minute*DefaultApprovalExpirationMinutes+time.Minute)))
+	batch, _ = service.QueryBatch(ctx, QueryBatchRequest{BatchID: batch.BatchID})
+	assert.Equal(s.T(), model.Rejected, batch.BatchStatus)
+	for _, leg := range batch.Transactions {
+		assert.Equal(s.T(), model.Rejected, leg.TransactionStatus)
+	}
+	s.validateAccounts(ctx, []model.Account{
+		{AccountID: 1, Balance: 10000000 - 6000000 - 3000000 + 6000000},
+		{AccountID: 2, Balance: 10000000 + 6000000 + 3000000 - 6000000},
+	})
+}
+
 func (s *transactionServiceSuite) Test_Multiple_Create_Happyflow() {
 	var (
 		req1To2Amount1 = CreateTransactionRequest{
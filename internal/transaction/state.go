@@ -0,0 +1,39 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"main/model"
+)
+
+var (
+	// ErrIllegalTransition indicates the status change is not an edge of the state machine, see model.TransactionStatus.CanTransitTo
+	ErrIllegalTransition = errors.New("illegal transaction status transition")
+	// ErrStatusChanged indicates the transaction is not in the expected status any more, it's changed by another process
+	ErrStatusChanged = errors.New("transaction status changed")
+)
+
+// TransitionError is returned when a status transition is rejected, it wraps ErrIllegalTransition or ErrStatusChanged.
+type TransitionError struct {
+	TransactionID string
+	From          model.TransactionStatus
+	To            model.TransactionStatus
+	// Current is the status in db when the transition is rejected
+	Current model.TransactionStatus
+	Err     error
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("%s: transaction %s from %d to %d, current status %d", e.Err, e.TransactionID, e.From, e.To, e.Current)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// asTransitionError returns the TransitionError in err if there is one
+func asTransitionError(err error) (*TransitionError, bool) {
+	var transitionErr *TransitionError
+	ok := errors.As(err, &transitionErr)
+	return transitionErr, ok
+}
@@ -9,6 +9,45 @@ import (
 
 type FundMovementStage int32
 
+type AccountStatus int32
+
+var (
+	AccountActive AccountStatus = 1
+	AccountFrozen AccountStatus = 2
+	AccountClosed AccountStatus = 3
+)
+
+func (s AccountStatus) String() string {
+	switch s {
+	case AccountActive:
+		return "active"
+	case AccountFrozen:
+		return "frozen"
+	case AccountClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+type AccountType int32
+
+var (
+	// AccountTypeUser is a normal account, balance can not be negative
+	AccountTypeUser AccountType = 1
+	// AccountTypeClearing is a system account represents fund outside of the system.
+	// Deposits are sent from it and withdrawals are sent to it, so its balance can be negative.
+	AccountTypeClearing AccountType = 2
+)
+
+const DefaultCurrency = "SGD"
+
+// SupportedCurrencies lists the ISO 4217 codes an account can be opened in.
+var SupportedCurrencies = map[string]bool{
+	"SGD": true,
+	"USD": true,
+}
+
 var (
 	Tried     FundMovementStage = 1
 	Confirmed FundMovementStage = 2
@@ -22,6 +61,9 @@ type FundMovement struct {
 	SourceAccountID      int               `gorm:"column:source_account_id" json:"source_account_id"`
 	DestinationAccountID int               `gorm:"column:destination_account_id" json:"destination_account_id"`
 	Amount               int64             `gorm:"column:amount" json:"amount"`
+	Fee                  int64             `gorm:"column:fee;not null;default:0" json:"fee"` // paid by source on top of amount
+	FeeAccountID         int               `gorm:"column:fee_account_id;not null;default:0" json:"fee_account_id"`
+	Currency             string            `gorm:"column:currency" json:"currency"`
 	CreatedAt            time.Time         `gorm:"column:created_at;autoCreateTime" json:"created_at"`
 	UpdatedAt            time.Time         `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
 }
@@ -31,14 +73,37 @@ func (FundMovement) TableName() string {
 	return "fund_movement_tab"
 }
 
+// AmountOf returns the amount moved out of or into the account, source pays amount and fee.
+func (fm FundMovement) AmountOf(accountID int) int64 {
+	switch accountID {
+	case fm.SourceAccountID:
+		return fm.Amount + fm.Fee
+	case fm.DestinationAccountID:
+		return fm.Amount
+	case fm.FeeAccountID:
+		return fm.Fee
+	default:
+		return 0
+	}
+}
+
 type Account struct {
-	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	AccountID  int       `gorm:"unique;not null" json:"account_id"`
-	Balance    int64     `gorm:"bigint;not null;default:0" json:"balance"`
-	InBalance  int64     `gorm:"bigint;not null;default:0" json:"in_balance"`
-	OutBalance int64     `gorm:"bigint;not null;default:0" json:"out_balance"`
-	CreatedAt  time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt  time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID         uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	AccountID  int           `gorm:"unique;not null" json:"account_id"`
+	Balance    int64         `gorm:"bigint;not null;default:0" json:"balance"`
+	InBalance  int64         `gorm:"bigint;not null;default:0" json:"in_balance"`
+	OutBalance int64         `gorm:"bigint;not null;default:0" json:"out_balance"`
+	Currency   string        `gorm:"type:char(3);not null;default:'SGD'" json:"currency"`
+	Status     AccountStatus `gorm:"type:int;not null;default:1" json:"status"`
+	Type       AccountType   `gorm:"type:int;not null;default:1" json:"type"`
+	// Transfer limits of outgoing amount, 0 means no limit
+	MaxSingleAmount int64 `gorm:"bigint;not null;default:0" json:"max_single_amount"`
+	DailyLimit      int64 `gorm:"bigint;not null;default:0" json:"daily_limit"`
+	MonthlyLimit    int64 `gorm:"bigint;not null;default:0" json:"monthly_limit"`
+	// CreditLimit allows balance goes negative down to -CreditLimit
+	CreditLimit int64     `gorm:"bigint;not null;default:0" json:"credit_limit"`
+	CreatedAt   time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
 // TableName sets the insert table name for this struct type.
@@ -46,9 +111,44 @@ func (Account) TableName() string {
 	return "account_tab"
 }
 
+func (a *Account) IsClearing() bool {
+	return a.Type == AccountTypeClearing
+}
+
+// CreditUsed returns the amount of credit line in use
+func (a *Account) CreditUsed() int64 {
+	if a.Balance >= 0 {
+		return 0
+	}
+	return -a.Balance
+}
+
+// ExceedsCreditLimit returns whether holding amount more would take the account beyond its credit line.
+// It's false for accounts without credit line, they run out of balance instead.
+func (a *Account) ExceedsCreditLimit(amount int64) bool {
+	if a.CreditLimit <= 0 || a.IsClearing() {
+		return false
+	}
+	available, err := utils.SafeAddSigned(a.Balance, -a.OutBalance, a.CreditLimit)
+	return err == nil && amount > available
+}
+
+// addBalance returns the balance after adding amounts. Balance can be negative down to the credit limit,
+// and there is no limit for clearing account.
+func (a *Account) addBalance(nums ...int64) (int64, error) {
+	sum, err := utils.SafeAddSigned(nums...)
+	if err != nil {
+		return 0, err
+	}
+	if !a.IsClearing() && sum < -a.CreditLimit {
+		return 0, utils.ErrNegativeValue
+	}
+	return sum, nil
+}
+
 func (a *Account) TryTransfer(tx *gorm.DB, amount int64) error {
 	// check if balance enough
-	if _, err := utils.SafeAdd(a.Balance, -a.OutBalance, -amount); err != nil {
+	if _, err := a.addBalance(a.Balance, -a.OutBalance, -amount); err != nil {
 		return err
 	}
 	// return latest out balance
@@ -65,7 +165,7 @@ func (a *Account) Transfer(tx *gorm.DB, amount int64) error {
 		outBalance int64
 	)
 
-	balance, err := utils.SafeAdd(a.Balance, -amount)
+	balance, err := a.addBalance(a.Balance, -amount)
 	if err != nil {
 		return err
 	}
@@ -81,7 +181,7 @@ func (a *Account) Transfer(tx *gorm.DB, amount int64) error {
 
 func (a *Account) TryReceive(tx *gorm.DB, amount int64) error {
 	// check if exceed limit
-	if _, err := utils.SafeAdd(a.Balance, a.InBalance, amount); err != nil {
+	if _, err := a.addBalance(a.Balance, a.InBalance, amount); err != nil {
 		return err
 	}
 	// return latest in balance
@@ -98,7 +198,7 @@ func (a *Account) Recieve(tx *gorm.DB, amount int64) error {
 		inBalance int64
 	)
 
-	balance, err := utils.SafeAdd(a.Balance, amount)
+	balance, err := a.addBalance(a.Balance, amount)
 	if err != nil {
 		return err
 	}
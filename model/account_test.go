@@ -76,6 +76,33 @@ func TestAccount_Transfer(t *testing.T) {
 	assert.EqualError(t, utils.ErrNegativeValue, err.Error())
 }
 
+func TestAccount_Transfer_Clearing_AllowNegativeBalance(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer func() {
+		db, err := db.DB()
+		if err == nil {
+			db.Close()
+		}
+	}()
+
+	account := model.Account{
+		AccountID:  1,
+		Balance:    0,
+		OutBalance: 300000,
+		Type:       model.AccountTypeClearing,
+	}
+	amount := int64(300000)
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "account_tab".*`).
+		WithArgs(-300000, 0, sqlmock.AnyArg(), account.AccountID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := account.Transfer(db, amount)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestAccount_TryReceive(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer func() {
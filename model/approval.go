@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+type ApprovalStatus int
+
+var (
+	ApprovalPending  ApprovalStatus = 1
+	ApprovalApproved ApprovalStatus = 2
+	ApprovalRejected ApprovalStatus = 3
+	// ApprovalExpired indicates nobody acted on the approval before ExpiredAt
+	ApprovalExpired ApprovalStatus = 4
+	// ApprovalCanceled indicates the transaction is canceled by sender before it's approved
+	ApprovalCanceled ApprovalStatus = 5
+)
+
+// Approval is the maker-checker record of a transfer or batch above the approval threshold.
+// RequestedBy is the user created the transfer, DecidedBy is the user approved or rejected it.
+type Approval struct {
+	ID            uint           `gorm:"primaryKey;autoIncrement" json:"-"`
+	TransactionID string         `gorm:"unique;not null" json:"transaction_id"`
+	Status        ApprovalStatus `gorm:"type:int;not null" json:"status"`
+	RequestedBy   string         `gorm:"not null;default:''" json:"requested_by"`
+	DecidedBy     string         `gorm:"not null;default:''" json:"decided_by,omitempty"`
+	DecidedAt     *time.Time     `json:"decided_at,omitempty"`
+	Note          string         `gorm:"type:text" json:"note,omitempty"`
+	ExpiredAt     time.Time      `gorm:"not null;index" json:"expired_at"`
+	CreatedAt     time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	// BatchID is set on the approval of a batch, TransactionID is the batch ID then and all legs are decided together
+	BatchID string `gorm:"not null;default:''" json:"batch_id,omitempty"`
+}
+
+// TableName sets the insert table name for this struct type.
+func (Approval) TableName() string {
+	return "approval_tab"
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"main/common/utils"
+	"time"
+)
+
+// Batch is the parent of the transfers from one source account to many destinations.
+// Its legs are transactions with the same BatchID, and they are either all fulfiled or all failed.
+type Batch struct {
+	ID              uint              `gorm:"primaryKey;autoIncrement" json:"-"`
+	BatchID         string            `gorm:"unique;not null" json:"batch_id"`
+	SourceAccountID int               `gorm:"not null" json:"source_account_id"`
+	TotalAmount     int64             `gorm:"type:decimal(20,8);not null" json:"total_amount,omitempty"`
+	Currency        string            `gorm:"type:char(3);not null" json:"currency"`
+	BatchStatus     TransactionStatus `gorm:"type:int;not null" json:"batch_status"`
+	CreatedAt       time.Time         `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
+	ExpiredAt       time.Time         `gorm:"expired_at" json:"expired_at"`
+	BatchAmount     string            `gorm:"-" json:"batch_amount,omitempty"`
+	Transactions    []Transaction     `gorm:"-" json:"transactions"`
+	// Approval is the approval of a batch awaiting approval, it's saved together with the batch
+	Approval *Approval `gorm:"-" json:"approval,omitempty"`
+}
+
+// TableName sets the insert table name for this struct type.
+func (Batch) TableName() string {
+	return "batch_tab"
+}
+
+func (b *Batch) FormatForDisplay() {
+	b.BatchAmount = utils.FormatInt(b.TotalAmount)
+	b.TotalAmount = 0
+	for i := range b.Transactions {
+		b.Transactions[i].FormatForDisplay()
+	}
+}
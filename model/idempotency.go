@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// IdempotencyKey binds a client's idempotency key to the transaction created by the first request,
+// RequestHash is the fingerprint of the request to detect key reused by a different request.
+type IdempotencyKey struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	ClientID       string    `gorm:"not null;uniqueIndex:idx_idempotency_client_key" json:"client_id"`
+	IdempotencyKey string    `gorm:"not null;uniqueIndex:idx_idempotency_client_key" json:"idempotency_key"`
+	RequestHash    string    `gorm:"not null" json:"request_hash"`
+	TransactionID  string    `gorm:"not null" json:"transaction_id"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName sets the insert table name for this struct type.
+func (IdempotencyKey) TableName() string {
+	return "idempotency_key_tab"
+}
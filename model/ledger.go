@@ -0,0 +1,136 @@
+package model
+
+import (
+	"time"
+)
+
+// LedgerBook is a sub ledger of an account. Each column of account_tab is a projection of a book:
+//   - balance = credits - debits of BookBalance
+//   - out_balance = debits - credits of BookOutHold
+//   - in_balance = credits - debits of BookInHold
+type LedgerBook string
+
+const (
+	BookBalance LedgerBook = "balance"
+	BookOutHold LedgerBook = "out_hold"
+	BookInHold  LedgerBook = "in_hold"
+	// BookOpening is the counterpart of account's initial balance
+	BookOpening LedgerBook = "opening"
+)
+
+type LedgerDirection int32
+
+var (
+	Debit  LedgerDirection = 1
+	Credit LedgerDirection = 2
+)
+
+type LedgerPhase string
+
+const (
+	PhaseOpen    LedgerPhase = "open"
+	PhaseTry     LedgerPhase = "try"
+	PhaseConfirm LedgerPhase = "confirm"
+	PhaseCancel  LedgerPhase = "cancel"
+)
+
+// LedgerEntry is an append only posting. Entries of the same transaction and phase is a journal,
+// and debits and credits of a journal are always balanced.
+type LedgerEntry struct {
+	ID            int64           `gorm:"primaryKey;column:id" json:"id"`
+	TransactionID string          `gorm:"column:transaction_id" json:"transaction_id"`
+	Phase         LedgerPhase     `gorm:"column:phase" json:"phase"`
+	AccountID     int             `gorm:"column:account_id" json:"account_id"`
+	Book          LedgerBook      `gorm:"column:book" json:"book"`
+	Direction     LedgerDirection `gorm:"column:direction" json:"direction"`
+	Amount        int64           `gorm:"column:amount" json:"amount"`
+	Currency      string          `gorm:"column:currency" json:"currency"`
+	CreatedAt     time.Time       `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TableName sets the insert table name for this struct type.
+func (LedgerEntry) TableName() string {
+	return "ledger_entry_tab"
+}
+
+type posting struct {
+	accountID int
+	book      LedgerBook
+	direction LedgerDirection
+	amount    int64
+}
+
+func newJournal(transactionID string, phase LedgerPhase, currency string, postings ...posting) []LedgerEntry {
+	entries := make([]LedgerEntry, 0, len(postings))
+	for _, p := range postings {
+		entries = append(entries, LedgerEntry{
+			TransactionID: transactionID,
+			Phase:         phase,
+			AccountID:     p.accountID,
+			Book:          p.book,
+			Direction:     p.direction,
+			Amount:        p.amount,
+			Currency:      currency,
+		})
+	}
+	return entries
+}
+
+// NewOpeningJournal records the initial balance of an account.
+func NewOpeningJournal(accountID int, amount int64, currency string) []LedgerEntry {
+	return newJournal("", PhaseOpen, currency,
+		posting{accountID, BookOpening, Debit, amount},
+		posting{accountID, BookBalance, Credit, amount},
+	)
+}
+
+// NewTryJournal holds amount on source's out balance and destination's in balance,
+// and holds fee on source's out balance and fee account's in balance.
+func NewTryJournal(fm FundMovement) []LedgerEntry {
+	postings := []posting{
+		{fm.SourceAccountID, BookOutHold, Debit, fm.Amount},
+		{fm.DestinationAccountID, BookInHold, Credit, fm.Amount},
+	}
+	if fm.Fee > 0 {
+		postings = append(postings,
+			posting{fm.SourceAccountID, BookOutHold, Debit, fm.Fee},
+			posting{fm.FeeAccountID, BookInHold, Credit, fm.Fee},
+		)
+	}
+	return newJournal(fm.TransactionID, PhaseTry, fm.Currency, postings...)
+}
+
+// NewConfirmJournal releases the holds and moves amount from source's balance to destination's balance,
+// and fee from source's balance to fee account's balance.
+func NewConfirmJournal(fm FundMovement) []LedgerEntry {
+	postings := []posting{
+		{fm.SourceAccountID, BookOutHold, Credit, fm.Amount},
+		{fm.DestinationAccountID, BookInHold, Debit, fm.Amount},
+		{fm.SourceAccountID, BookBalance, Debit, fm.Amount},
+		{fm.DestinationAccountID, BookBalance, Credit, fm.Amount},
+	}
+	if fm.Fee > 0 {
+		postings = append(postings,
+			posting{fm.SourceAccountID, BookOutHold, Credit, fm.Fee},
+			posting{fm.FeeAccountID, BookInHold, Debit, fm.Fee},
+			posting{fm.SourceAccountID, BookBalance, Debit, fm.Fee},
+			posting{fm.FeeAccountID, BookBalance, Credit, fm.Fee},
+		)
+	}
+	return newJournal(fm.TransactionID, PhaseConfirm, fm.Currency, postings...)
+}
+
+// NewCancelJournal releases the holds.
+func NewCancelJournal(fm FundMovement) []LedgerEntry {
+	postings := []posting{
+		{fm.SourceAccountID, BookOutHold, Credit, fm.Amount},
+		{fm.DestinationAccountID, BookInHold, Debit, fm.Amount},
+	}
+	if fm.Fee > 0 {
+		postings = append(postings,
+			posting{fm.SourceAccountID, BookOutHold, Credit, fm.Fee},
+			posting{fm.FeeAccountID, BookInHold, Debit, fm.Fee},
+		)
+	}
+	return newJournal(fm.TransactionID, PhaseCancel, fm.Currency, postings...)
+}
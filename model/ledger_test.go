@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Journals_Balanced(t *testing.T) {
+	fm := FundMovement{
+		TransactionID:        "123",
+		SourceAccountID:      1,
+		DestinationAccountID: 2,
+		Amount:               1000000,
+		Currency:             DefaultCurrency,
+	}
+	withFee := fm
+	withFee.Fee, withFee.FeeAccountID = 10000, 3
+
+	for _, journal := range [][]LedgerEntry{
+		NewOpeningJournal(1, 1000000, DefaultCurrency),
+		NewTryJournal(fm),
+		NewConfirmJournal(fm),
+		NewCancelJournal(fm),
+		NewTryJournal(withFee),
+		NewConfirmJournal(withFee),
+		NewCancelJournal(withFee),
+	} {
+		var debits, credits int64
+		for _, entry := range journal {
+			if entry.Direction == Debit {
+				debits += entry.Amount
+			} else {
+				credits += entry.Amount
+			}
+		}
+		assert.Equal(t, debits, credits, "journal %v not balanced", journal[0].Phase)
+	}
+}
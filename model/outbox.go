@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// OutboxEvent is a stage change of a fund movement. It's written in the same db transaction as the change,
+// and relayed to transaction_tab by outbox relay, so the transaction status follows the fund movement even if
+// the process made the change dies before updating it.
+type OutboxEvent struct {
+	ID            int64             `gorm:"primaryKey;column:id" json:"id"`
+	TransactionID string            `gorm:"column:transaction_id" json:"transaction_id"`
+	Stage         FundMovementStage `gorm:"column:stage" json:"stage"`
+	// RelayedAt is nil until the stage is applied to the transaction
+	RelayedAt *time.Time `gorm:"column:relayed_at" json:"relayed_at,omitempty"`
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+}
+
+// TableName sets the insert table name for this struct type.
+func (OutboxEvent) TableName() string {
+	return "outbox_tab"
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"main/common/utils"
+	"time"
+)
+
+type StandingOrderStatus int
+
+var (
+	StandingOrderActive StandingOrderStatus = 1
+	StandingOrderPaused StandingOrderStatus = 2
+	// StandingOrderCompleted indicates the standing order passed its end time
+	StandingOrderCompleted StandingOrderStatus = 3
+	StandingOrderCanceled  StandingOrderStatus = 4
+)
+
+// FailurePolicy decides what to do when a run fails with insufficient balance
+type FailurePolicy string
+
+const (
+	// FailurePolicySkip skips the failed run and waits for next run
+	FailurePolicySkip FailurePolicy = "skip"
+	// FailurePolicyRetry retries the failed run later, and skips it after retries are exhausted
+	FailurePolicyRetry FailurePolicy = "retry"
+	// FailurePolicyPause pauses the standing order until it's resumed
+	FailurePolicyPause FailurePolicy = "pause"
+)
+
+// StandingOrder is a rule creating a transfer on every run of its schedule.
+// ScheduledAt is the run being executed, NextRunAt is when it's executed, it's later than ScheduledAt when the run is retried.
+type StandingOrder struct {
+	ID                   uint                `gorm:"primaryKey;autoIncrement" json:"-"`
+	StandingOrderID      string              `gorm:"unique;not null" json:"standing_order_id"`
+	SourceAccountID      int                 `gorm:"not null;index" json:"source_account_id"`
+	DestinationAccountID int                 `gorm:"not null" json:"destination_account_id"`
+	Amount               int64               `gorm:"type:decimal(20,8);not null" json:"amount,omitempty"`
+	Currency             string              `gorm:"type:char(3);not null" json:"currency"`
+	Schedule             string              `gorm:"not null" json:"schedule"`
+	FailurePolicy        FailurePolicy       `gorm:"not null" json:"failure_policy"`
+	Status               StandingOrderStatus `gorm:"type:int;not null" json:"status"`
+	ScheduledAt          time.Time           `gorm:"not null" json:"scheduled_at"`
+	NextRunAt            time.Time           `gorm:"not null;index" json:"next_run_at"`
+	Attempts             int                 `gorm:"not null;default:0" json:"attempts"`
+	EndAt                *time.Time          `json:"end_at,omitempty"`
+	CreatedAt            time.Time           `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt            time.Time           `gorm:"autoUpdateTime" json:"updated_at"`
+	StandingOrderAmount  string              `gorm:"-" json:"standing_order_amount,omitempty"`
+}
+
+// TableName sets the insert table name for this struct type.
+func (StandingOrder) TableName() string {
+	return "standing_order_tab"
+}
+
+func (o *StandingOrder) FormatForDisplay() {
+	o.StandingOrderAmount = utils.FormatInt(o.Amount)
+	o.Amount = 0
+}
+
+// StandingOrderRun is an attempt of a standing order run, and the transaction it created
+type StandingOrderRun struct {
+	ID                uint              `gorm:"primaryKey;autoIncrement" json:"-"`
+	StandingOrderID   string            `gorm:"not null;index" json:"standing_order_id"`
+	TransactionID     string            `gorm:"not null" json:"transaction_id"`
+	ScheduledAt       time.Time         `gorm:"not null" json:"scheduled_at"`
+	Attempt           int               `gorm:"not null" json:"attempt"`
+	TransactionStatus TransactionStatus `gorm:"type:int;not null" json:"transaction_status"`
+	Error             string            `json:"error,omitempty"`
+	CreatedAt         time.Time         `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName sets the insert table name for this struct type.
+func (StandingOrderRun) TableName() string {
+	return "standing_order_run_tab"
+}
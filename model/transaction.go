@@ -12,6 +12,65 @@ var (
 	Processing TransactionStatus = 2
 	Fulfiled   TransactionStatus = 3
 	Failed     TransactionStatus = 5
+	// Refunded indicates the whole amount of a fulfiled transaction is refunded
+	Refunded TransactionStatus = 6
+	// PartiallyRefunded indicates part of the amount of a fulfiled transaction is refunded
+	PartiallyRefunded TransactionStatus = 7
+	// Scheduled indicates the transaction will be processed at ExecuteAt
+	Scheduled TransactionStatus = 8
+	// Revoked indicates the transaction is canceled by sender before it's started or confirmed
+	Revoked TransactionStatus = 9
+	// ManualHandling indicates retries of confirm or cancel are exhausted, it waits for an operator to resolve it
+	ManualHandling TransactionStatus = 10
+	// Closed indicates an operator closed the transaction without moving fund any further
+	Closed TransactionStatus = 11
+	// Authorized indicates a transaction created with capture false is tried, fund is held until it's captured or voided
+	Authorized TransactionStatus = 12
+	// Voided indicates an authorized transaction is voided by client or expired, held fund is released
+	Voided TransactionStatus = 13
+	// AwaitingApproval indicates a transfer above the approval threshold waits for a second user to approve or reject it
+	AwaitingApproval TransactionStatus = 14
+	// Rejected indicates the approval of the transaction is rejected or expired, no fund is moved
+	Rejected TransactionStatus = 15
+)
+
+// transitions are the legal status changes, final statuses like Failed and Revoked have no way out.
+// A processing transaction has its fund movement tried and is decided to be confirmed, it's never canceled.
+// A voided or revoked transaction goes to ManualHandling if its fund movement can not be canceled.
+var transitions = map[TransactionStatus][]TransactionStatus{
+	AwaitingApproval:  {Pending, Scheduled, Rejected, Revoked},
+	Scheduled:         {Pending, Revoked},
+	Pending:           {Processing, Authorized, Failed, Revoked, ManualHandling},
+	Authorized:        {Processing, Voided},
+	Voided:            {ManualHandling},
+	Revoked:           {ManualHandling},
+	Processing:        {Fulfiled, ManualHandling},
+	ManualHandling:    {Fulfiled, Failed, Closed},
+	Fulfiled:          {PartiallyRefunded, Refunded},
+	PartiallyRefunded: {Refunded},
+}
+
+// CanTransitTo returns whether a transaction can move from s to the status
+func (s TransactionStatus) CanTransitTo(status TransactionStatus) bool {
+	for _, to := range transitions[s] {
+		if to == status {
+			return true
+		}
+	}
+	return false
+}
+
+type TransactionType int
+
+var (
+	// Transfer between two user accounts
+	Transfer TransactionType = 1
+	// Deposit from clearing account to user account
+	Deposit TransactionType = 2
+	// Withdrawal from user account to clearing account
+	Withdrawal TransactionType = 3
+	// Refund from destination back to source of a fulfiled transaction
+	Refund TransactionType = 4
 )
 
 type Transaction struct {
@@ -20,12 +79,36 @@ type Transaction struct {
 	SourceAccountID      int               `gorm:"not null" json:"source_account_id"`
 	DestinationAccountID int               `gorm:"not null" json:"destination_account_id"`
 	Amount               int64             `gorm:"type:decimal(20,8);not null" json:"amount,omitempty"`
+	Currency             string            `gorm:"type:char(3);not null" json:"currency"`
 	TransactionStatus    TransactionStatus `gorm:"type:int;not null" json:"transaction_status"`
-	CreatedAt            time.Time         `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt            time.Time         `gorm:"autoUpdateTime" json:"updated_at"`
-	ExpiredAt            time.Time         `gorm:"expired_at" json:"expired_at"`
-	Retries              int               `gorm:"-" json:"-"`
-	TransactionAmount    string            `gorm:"-" json:"transaction_amount,omitempty"`
+	TransactionType      TransactionType   `gorm:"type:int;not null;default:1" json:"transaction_type"`
+	// OriginalTransactionID is the refunded transaction of a refund
+	OriginalTransactionID string `gorm:"index" json:"original_transaction_id,omitempty"`
+	// BatchID is the batch of a leg of batch transfer
+	BatchID string `gorm:"index;not null;default:''" json:"batch_id,omitempty"`
+	// StandingOrderID is the standing order created the transaction
+	StandingOrderID string `gorm:"index" json:"standing_order_id,omitempty"`
+	// ExecuteAt is the due time of a scheduled transaction
+	ExecuteAt *time.Time `gorm:"index" json:"execute_at,omitempty"`
+	// ManualCapture is set by creating with capture false, transaction stops at Authorized after try
+	ManualCapture bool `gorm:"not null;default:false" json:"manual_capture,omitempty"`
+	// Fee is charged from source on top of Amount, and credited to FeeAccountID
+	Fee          int64 `gorm:"type:decimal(20,8);not null;default:0" json:"fee,omitempty"`
+	FeeAccountID int   `gorm:"not null;default:0" json:"fee_account_id,omitempty"`
+	// CreatedBy is the user created the transaction, only the user can cancel it
+	CreatedBy string `gorm:"not null;default:''" json:"created_by,omitempty"`
+	// LastError is the error of the last failed confirm or cancel
+	LastError string `gorm:"type:text" json:"last_error,omitempty"`
+	// Attempts is the number of failed confirm or cancel, NextRetryAt is when retry worker tries it again
+	Attempts          int        `gorm:"not null;default:0" json:"attempts,omitempty"`
+	NextRetryAt       *time.Time `gorm:"index" json:"next_retry_at,omitempty"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+	ExpiredAt         time.Time  `gorm:"expired_at" json:"expired_at"`
+	TransactionAmount string     `gorm:"-" json:"transaction_amount,omitempty"`
+	TransactionFee    string     `gorm:"-" json:"transaction_fee,omitempty"`
+	// Approval is the approval of a transaction awaiting approval, it's saved together with the transaction
+	Approval *Approval `gorm:"-" json:"approval,omitempty"`
 }
 
 // TableName sets the insert table name for this struct type.
@@ -36,4 +119,8 @@ func (Transaction) TableName() string {
 func (t *Transaction) FormatForDisplay() {
 	t.TransactionAmount = utils.FormatInt(t.Amount)
 	t.Amount = 0
+	if t.Fee > 0 {
+		t.TransactionFee = utils.FormatInt(t.Fee)
+		t.Fee = 0
+	}
 }
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// TransactionEvent records a status change of a transaction. FromStatus is 0 when the transaction is created.
+type TransactionEvent struct {
+	ID            uint              `gorm:"primaryKey;autoIncrement" json:"-"`
+	TransactionID string            `gorm:"not null;index" json:"transaction_id"`
+	FromStatus    TransactionStatus `gorm:"type:int;not null" json:"from_status"`
+	ToStatus      TransactionStatus `gorm:"type:int;not null" json:"to_status"`
+	Reason        string            `json:"reason"`
+	Actor         string            `gorm:"not null" json:"actor"`
+	CreatedAt     time.Time         `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName sets the insert table name for this struct type.
+func (TransactionEvent) TableName() string {
+	return "transaction_event_tab"
+}
@@ -21,3 +21,22 @@ func Test_Display(t *testing.T) {
 	assert.True(t, !strings.Contains(string(bs), "amount:"))
 
 }
+
+func Test_TransactionStatus_CanTransitTo(t *testing.T) {
+	assert.True(t, Pending.CanTransitTo(Processing))
+	assert.True(t, Pending.CanTransitTo(Failed))
+	assert.True(t, Processing.CanTransitTo(Fulfiled))
+	assert.True(t, Scheduled.CanTransitTo(Revoked))
+	assert.True(t, Fulfiled.CanTransitTo(Refunded))
+	assert.True(t, AwaitingApproval.CanTransitTo(Pending))
+	assert.True(t, AwaitingApproval.CanTransitTo(Rejected))
+
+	assert.False(t, Pending.CanTransitTo(Fulfiled))
+	assert.False(t, Processing.CanTransitTo(Failed))
+	assert.False(t, Fulfiled.CanTransitTo(Failed))
+	assert.False(t, Failed.CanTransitTo(Processing))
+	assert.False(t, Revoked.CanTransitTo(Pending))
+	assert.False(t, Refunded.CanTransitTo(PartiallyRefunded))
+	assert.False(t, AwaitingApproval.CanTransitTo(Processing))
+	assert.False(t, Rejected.CanTransitTo(Pending))
+}
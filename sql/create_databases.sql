@@ -14,6 +14,13 @@ CREATE TABLE IF NOT EXISTS account_tab (
     balance BIGINT NOT NULL DEFAULT 0,
     out_balance BIGINT NOT NULL DEFAULT 0,
     in_balance BIGINT NOT NULL DEFAULT 0, 
+    currency CHAR(3) NOT NULL DEFAULT 'SGD',
+    status INT NOT NULL DEFAULT 1,
+    type INT NOT NULL DEFAULT 1,
+    max_single_amount BIGINT NOT NULL DEFAULT 0,
+    daily_limit BIGINT NOT NULL DEFAULT 0,
+    monthly_limit BIGINT NOT NULL DEFAULT 0,
+    credit_limit BIGINT NOT NULL DEFAULT 0,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -26,10 +33,53 @@ CREATE TABLE IF NOT EXISTS fund_movement_tab (
     source_account_id INT NOT NULL,
     destination_account_id INT NOT NULL,
     amount BIGINT NOT NULL,
+    fee BIGINT NOT NULL DEFAULT 0,
+    fee_account_id INT NOT NULL DEFAULT 0,
+    currency CHAR(3) NOT NULL DEFAULT '',
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE TABLE IF NOT EXISTS ledger_entry_tab (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id CHAR(36) NOT NULL,
+    phase VARCHAR(16) NOT NULL,
+    account_id INT NOT NULL,
+    book VARCHAR(16) NOT NULL,
+    direction INT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ledger_entry_account ON ledger_entry_tab(account_id, book);
+CREATE INDEX idx_ledger_entry_transaction ON ledger_entry_tab(transaction_id, phase);
+
+-- fund movement stage changes relayed to transaction_db
+CREATE TABLE IF NOT EXISTS outbox_tab (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id CHAR(36) NOT NULL,
+    stage INT NOT NULL,
+    relayed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_unrelayed ON outbox_tab(id) WHERE relayed_at IS NULL;
+
+-- ledger is append only
+CREATE RULE ledger_entry_no_update AS ON UPDATE TO ledger_entry_tab DO INSTEAD NOTHING;
+CREATE RULE ledger_entry_no_delete AS ON DELETE TO ledger_entry_tab DO INSTEAD NOTHING;
+
+-- clearing accounts for deposits and withdrawals, keep them same as clearing_accounts in config.json
+INSERT INTO account_tab (account_id, currency, type) VALUES (999999001, 'SGD', 2), (999999002, 'USD', 2);
+-- fee accounts collecting transfer fees, keep them same as fee_accounts in config.json
+INSERT INTO account_tab (account_id, currency) VALUES (999999101, 'SGD'), (999999102, 'USD');
+
+CREATE INDEX idx_fund_movement_source_created ON fund_movement_tab(source_account_id, created_at);
+CREATE INDEX idx_fund_movement_source_updated ON fund_movement_tab(source_account_id, updated_at);
+CREATE INDEX idx_fund_movement_destination_updated ON fund_movement_tab(destination_account_id, updated_at);
+CREATE INDEX idx_fund_movement_fee_account_updated ON fund_movement_tab(fee_account_id, updated_at);
+
 
 \c transaction_db
 
@@ -39,11 +89,121 @@ CREATE TABLE IF NOT EXISTS transaction_tab (
     source_account_id INT NOT NULL,
     destination_account_id INT NOT NULL,
     amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    fee BIGINT NOT NULL DEFAULT 0,
+    fee_account_id INT NOT NULL DEFAULT 0,
+    created_by VARCHAR(64) NOT NULL DEFAULT '',
     transaction_status INT NOT NULL,
+    transaction_type INT NOT NULL DEFAULT 1,
+    original_transaction_id CHAR(36),
+    batch_id CHAR(36) NOT NULL DEFAULT '',
+    execute_at TIMESTAMP,
+    standing_order_id CHAR(36),
+    manual_capture BOOLEAN NOT NULL DEFAULT FALSE,
+    last_error TEXT,
+    attempts INT NOT NULL DEFAULT 0,
+    next_retry_at TIMESTAMP,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     expired_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE INDEX idx_transactions_status ON transaction_tab(transaction_status);
-CREATE INDEX idx_transactions_expired_status ON transaction_tab(expired_at, transaction_status);
\ No newline at end of file
+CREATE INDEX idx_transactions_expired_status ON transaction_tab(expired_at, transaction_status);
+CREATE INDEX idx_transactions_original_transaction_id ON transaction_tab(original_transaction_id);
+CREATE INDEX idx_transactions_batch_id ON transaction_tab(batch_id);
+CREATE INDEX idx_transactions_status_execute_at ON transaction_tab(transaction_status, execute_at);
+CREATE INDEX idx_transactions_standing_order_id ON transaction_tab(standing_order_id);
+CREATE INDEX idx_transactions_status_next_retry_at ON transaction_tab(transaction_status, next_retry_at);
+-- listing transactions, ordered by created_at DESC, id DESC
+CREATE INDEX idx_transactions_created_at_id ON transaction_tab(created_at, id);
+CREATE INDEX idx_transactions_source_created_at ON transaction_tab(source_account_id, created_at, id);
+CREATE INDEX idx_transactions_destination_created_at ON transaction_tab(destination_account_id, created_at, id);
+CREATE INDEX idx_transactions_status_created_at ON transaction_tab(transaction_status, created_at, id);
+
+CREATE TABLE IF NOT EXISTS batch_tab (
+    id SERIAL PRIMARY KEY,
+    batch_id CHAR(36) UNIQUE NOT NULL,
+    source_account_id INT NOT NULL,
+    total_amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    batch_status INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expired_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_batches_expired_status ON batch_tab(expired_at, batch_status);
+
+CREATE TABLE IF NOT EXISTS approval_tab (
+    id SERIAL PRIMARY KEY,
+    transaction_id CHAR(36) UNIQUE NOT NULL,
+    status INT NOT NULL,
+    requested_by VARCHAR(64) NOT NULL DEFAULT '',
+    decided_by VARCHAR(64) NOT NULL DEFAULT '',
+    decided_at TIMESTAMP,
+    note TEXT,
+    expired_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    batch_id CHAR(36) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_approvals_status_expired_at ON approval_tab(status, expired_at);
+
+CREATE TABLE IF NOT EXISTS idempotency_key_tab (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(64) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    transaction_id CHAR(36) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (client_id, idempotency_key)
+);
+
+CREATE TABLE IF NOT EXISTS standing_order_tab (
+    id SERIAL PRIMARY KEY,
+    standing_order_id CHAR(36) UNIQUE NOT NULL,
+    source_account_id INT NOT NULL,
+    destination_account_id INT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    schedule VARCHAR(64) NOT NULL,
+    failure_policy VARCHAR(16) NOT NULL,
+    status INT NOT NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    next_run_at TIMESTAMP NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    end_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_standing_orders_source_account_id ON standing_order_tab(source_account_id);
+CREATE INDEX idx_standing_orders_status_next_run_at ON standing_order_tab(status, next_run_at);
+
+CREATE TABLE IF NOT EXISTS standing_order_run_tab (
+    id SERIAL PRIMARY KEY,
+    standing_order_id CHAR(36) NOT NULL,
+    transaction_id CHAR(36) NOT NULL,
+    scheduled_at TIMESTAMP NOT NULL,
+    attempt INT NOT NULL,
+    transaction_status INT NOT NULL,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_standing_order_runs_standing_order_id ON standing_order_run_tab(standing_order_id);
+
+-- status history of transactions
+CREATE TABLE IF NOT EXISTS transaction_event_tab (
+    id SERIAL PRIMARY KEY,
+    transaction_id CHAR(36) NOT NULL,
+    from_status INT NOT NULL,
+    to_status INT NOT NULL,
+    reason TEXT,
+    actor VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_transaction_events_transaction_id ON transaction_event_tab(transaction_id);